@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	restAPI "github.com/iasthc/hsuan-fuzz/pkg/rest-api"
+)
+
+// export writes a curl script and a Go test for every crasher.
+func export(args []string) {
+
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	o := fs.String("o", ".", "location of `oenapi` specification ")
+	c := fs.String("c", ".", "location of `corpus`")
+	s := fs.Bool("s", false, "`strict` mode, the token is refreshed first")
+	fs.Parse(args)
+
+	x, err := restAPI.New(*o, *c, false, *s)
+	if err != nil {
+		panic(err)
+	}
+
+	if *s {
+		if err := x.RefreshToken(); err != nil {
+			panic(err)
+		}
+	}
+
+	dirs := fs.Args()
+	if len(dirs) == 0 {
+		dirs = []string{x.CrashersDir()}
+	}
+
+	for _, dir := range dirs {
+
+		n, err := x.ExportDir(dir)
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Printf("%d crashers exported to %s\n", n, dir)
+
+	}
+
+}
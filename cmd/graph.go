@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	restAPI "github.com/iasthc/hsuan-fuzz/pkg/rest-api"
+)
+
+// graph renders Dependency.yml as Graphviz DOT or Mermaid, the operations below level 6 of the last campaign are highlighted.
+func graph(args []string) {
+
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+	o := fs.String("o", ".", "location of `oenapi` specification ")
+	c := fs.String("c", ".", "location of `corpus`")
+	d := fs.String("d", "", "location of `Dependency.yml`, the one of the corpus by default, Learned.yml of the same directory is added")
+	f := fs.String("f", restAPI.GraphDOT, "`format` of the graph: dot or mermaid")
+	w := fs.String("w", "", "write to the `file` instead of printing")
+	fs.Parse(args)
+
+	x, err := restAPI.New(*o, *c, false, false)
+	if err != nil {
+		panic(err)
+	}
+
+	if *d == "" {
+		*d = x.DependencyPath()
+	}
+
+	// The graph helps to fix the problems, so they are only reported
+	dependency, problems, err := x.ReadDependency(*d)
+	if err != nil {
+		panic(err)
+	}
+	for _, p := range problems {
+		fmt.Fprintln(os.Stderr, p)
+	}
+
+	// Summaries of former campaigns have no operations, their levels may be of another specification
+	var cov *restAPI.Coverage
+	if summary, err := x.ReadSummary(); err == nil {
+		cov = &summary.Coverage
+		if len(cov.Operations) != len(cov.Levels) {
+			fmt.Fprintln(os.Stderr, "the coverage of the last campaign has no operations, run it again to show the levels")
+		}
+	}
+
+	out := os.Stdout
+	if *w != "" {
+		out, err = os.Create(*w)
+		if err != nil {
+			panic(err)
+		}
+		defer out.Close()
+	}
+
+	if err := x.WriteGraph(out, *f, dependency, cov); err != nil {
+		panic(err)
+	}
+
+}
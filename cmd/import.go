@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	restAPI "github.com/iasthc/hsuan-fuzz/pkg/rest-api"
+)
+
+// importSeeds imports the recorded requests of HAR files, Postman collections and access logs as seeds of the corpus.
+func importSeeds(args []string) {
+
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	o := fs.String("o", ".", "location of `oenapi` specification ")
+	c := fs.String("c", ".", "location of `corpus`")
+	format := fs.String("f", "", "`format` of the files: har, postman or log, guessed from the file name by default")
+	fs.Parse(args)
+
+	x, err := restAPI.New(*o, *c, false, false)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, file := range fs.Args() {
+
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+
+		f := *format
+		if f == "" {
+			f = restAPI.GetFormat(file)
+		}
+
+		requests, err := restAPI.ParseRecorded(f, b)
+		if err != nil {
+			panic(err)
+		}
+
+		n, err := x.ImportRecorded(requests)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("%d/%d requests of %s imported\n", n, len(requests), file)
+		for _, operation := range x.UnmatchedRecorded(requests) {
+			fmt.Println("  unmatched:", operation)
+		}
+
+	}
+
+	fmt.Println("seeds are saved to", x.SeedsDir(), "and added to the corpus of every campaign")
+
+}
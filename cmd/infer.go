@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	restAPI "github.com/iasthc/hsuan-fuzz/pkg/rest-api"
+	"gopkg.in/yaml.v2"
+)
+
+// infer prints the dependencies proposed from the specification, to be compared with or replace Dependency.yml.
+func infer(args []string) {
+
+	fs := flag.NewFlagSet("infer", flag.ExitOnError)
+	o := fs.String("o", ".", "location of `oenapi` specification ")
+	c := fs.String("c", ".", "location of `corpus`")
+	w := fs.String("w", "", "write to the `file` instead of printing")
+	fs.Parse(args)
+
+	x, err := restAPI.New(*o, *c, false, false)
+	if err != nil {
+		panic(err)
+	}
+
+	encoded, err := yaml.Marshal(x.InferDependency())
+	if err != nil {
+		panic(err)
+	}
+
+	if *w == "" {
+		fmt.Print(string(encoded))
+		return
+	}
+
+	err = ioutil.WriteFile(*w, encoded, 0644)
+	if err != nil {
+		panic(err)
+	}
+
+}
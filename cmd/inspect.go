@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	restAPI "github.com/iasthc/hsuan-fuzz/pkg/rest-api"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// inspect pretty-prints corpus entries, readable seeds and crashers, every corpus entry by default.
+func inspect(args []string) {
+
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	o := fs.String("o", ".", "location of `oenapi` specification ")
+	c := fs.String("c", ".", "location of `corpus`")
+	j := fs.Bool("json", false, "print as protobuf `JSON`")
+	fs.Parse(args)
+
+	files := fs.Args()
+	if len(files) == 0 {
+
+		x, err := restAPI.New(*o, *c, false, false)
+		if err != nil {
+			panic(err)
+		}
+
+		matches, err := filepath.Glob(filepath.Join(x.CorpusDir(), "*"))
+		if err != nil {
+			panic(err)
+		}
+
+		// Only the protobuf entries, their readable forms are the same
+		for _, file := range matches {
+			if !strings.Contains(filepath.Base(file), ".") {
+				files = append(files, file)
+			}
+		}
+		sort.Strings(files)
+
+	}
+
+	for _, file := range files {
+
+		info, err := restAPI.ReadInfo(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, file, err)
+			continue
+		}
+
+		fmt.Println("#", file)
+		if *j {
+			fmt.Println(protojson.Format(info))
+		} else {
+			fmt.Print(restAPI.FormatInfo(info))
+		}
+
+	}
+
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	restAPI "github.com/iasthc/hsuan-fuzz/pkg/rest-api"
+)
+
+// replay sends the crashers again and reports whether they still reproduce.
+// It exits with 1 if any does, otherwise with 2 if any gets no answer from the target.
+func replay(args []string) {
+
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	o := fs.String("o", ".", "location of `oenapi` specification ")
+	c := fs.String("c", ".", "location of `corpus`")
+	s := fs.Bool("s", false, "`strict` mode")
+	k := fs.Bool("k", false, "skip TLS verification (`insecure`)")
+	jar := fs.Bool("jar", false, "keep the `cookies` of the responses for each principal")
+	oracles := fs.String("oracle", "server-error,error-leak,schema,undocumented,bola,auth-bypass", "comma-separated built-in `oracles`")
+	fs.Parse(args)
+
+	x, err := restAPI.New(*o, *c, false, *s)
+	if err != nil {
+		panic(err)
+	}
+	x.Transport.InsecureSkipVerify = *k
+	x.CookieJar = *jar
+	if err := x.EnableOracles(*oracles); err != nil {
+		panic(err)
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{x.CrashersDir()}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	reproduced, inconclusive := false, false
+	for _, p := range paths {
+
+		results, err := x.ReplayFileContext(ctx, p)
+		if err != nil {
+			panic(err)
+		}
+
+		for _, r := range results {
+
+			status := "-"
+			switch {
+			case r.Inconclusive:
+				status = "ERROR"
+				inconclusive = true
+			case r.Expected == nil:
+			case r.Reproduced:
+				status = "REPRODUCED"
+				reproduced = true
+			default:
+				status = "FIXED"
+			}
+
+			fmt.Printf("%-10s %d %-7s %s %s\n", status, r.Info.Code, r.Node.Method, r.Node.Path, r.Name)
+			for _, f := range r.Findings {
+				fmt.Printf("           [%s] %s/%s: %s\n", f.Severity, f.Oracle, f.Category, f.Message)
+			}
+
+		}
+
+	}
+
+	if reproduced {
+		os.Exit(1)
+	}
+	if inconclusive {
+		os.Exit(2)
+	}
+
+}
@@ -1,7 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	restAPI "github.com/iasthc/hsuan-fuzz/pkg/rest-api"
 )
@@ -11,22 +18,97 @@ var (
 	inputPath   string
 	strictMode  bool
 	guideMode   bool
+	budget      restAPI.Budget
+	workers     int
+	politeness  restAPI.Politeness
+	seed        int64
+	transport   restAPI.Transport
+	caFile      string
+	oracles     string
+	minimize    bool
+	keep        bool
+	cookieJar   bool
+	learn       bool
 )
 
+// commands are the subcommands, running without a subcommand starts fuzzing.
+var commands = map[string]func(args []string){
+	"triage":  triage,
+	"replay":  replay,
+	"export":  export,
+	"inspect": inspect,
+	"import":  importSeeds,
+	"infer":   infer,
+	"graph":   graph,
+}
+
 func init() {
 
 	flag.StringVar(&openAPIPath, "o", ".", "location of `oenapi` specification ")
 	flag.StringVar(&inputPath, "c", ".", "location to save `corpus`")
 	flag.BoolVar(&strictMode, "s", false, "`strict` mode")
 	flag.BoolVar(&guideMode, "g", false, "`guided` mode")
+	flag.Int64Var(&seed, "seed", 0, "`seed` of the campaign, 0 means a random seed")
+	flag.IntVar(&workers, "w", 1, "number of `workers` sending groups in parallel, a seed only reproduces the campaign with -w 1")
+	flag.IntVar(&budget.Iterations, "n", 0, "maximum `iterations`, 0 means unlimited")
+	flag.DurationVar(&budget.Duration, "d", time.Duration(0), "maximum `duration`, 0 means unlimited")
+	flag.IntVar(&budget.Requests, "r", 0, "maximum `requests`, 0 means unlimited")
+	flag.BoolVar(&budget.StopOnCrash, "x", false, "stop on the first `crasher`")
+	flag.IntVar(&budget.Plateau, "p", 0, "stop when coverage has not increased for N `iterations`, 0 means unlimited")
+	flag.Float64Var(&politeness.Rate, "rate", 0, "maximum `requests` per second, 0 means unlimited")
+	flag.IntVar(&politeness.Burst, "burst", 1, "maximum `requests` sent at once")
+	flag.IntVar(&politeness.MaxRetries, "retry", 3, "maximum `retries` on 429 and 503")
+	flag.DurationVar(&transport.Timeout, "timeout", time.Duration(0), "total `timeout` of each request, 0 means no timeout")
+	flag.StringVar(&transport.Proxy, "proxy", "", "HTTP `proxy` url")
+	flag.StringVar(&caFile, "cacert", "", "`CA` bundle to verify the server")
+	flag.StringVar(&transport.CertFile, "cert", "", "client `certificate` for mTLS")
+	flag.StringVar(&transport.KeyFile, "key", "", "client `key` for mTLS")
+	flag.BoolVar(&minimize, "m", false, "`minimize` each new crasher")
+	flag.StringVar(&oracles, "oracle", "server-error", "comma-separated built-in `oracles`: server-error, error-leak, schema, undocumented, bola, auth-bypass")
+	flag.BoolVar(&transport.InsecureSkipVerify, "k", false, "skip TLS verification (`insecure`)")
+	flag.BoolVar(&cookieJar, "jar", false, "keep the `cookies` of the responses for each principal")
+	flag.BoolVar(&learn, "learn", false, "`learn` dependencies from the values of the responses")
+	flag.BoolVar(&keep, "keep", false, "`keep` the corpus of previous campaigns, the seeds of the seeds directory are always kept")
 
 }
 
 func main() {
+
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
+	}
+
 	flag.Parse()
-	x, err := restAPI.New(openAPIPath, inputPath, true, strictMode)
+	x, err := restAPI.New(openAPIPath, inputPath, !keep, strictMode)
+	if invalid := (*restAPI.DependencyError)(nil); errors.As(err, &invalid) {
+		log.Fatalln(err)
+	}
+	if edited := (*restAPI.EditedSeedsError)(nil); errors.As(err, &edited) {
+		log.Fatalln(err)
+	}
 	if err != nil {
 		panic(err)
 	}
-	x.Fuzz(guideMode)
+	x.Politeness = politeness
+	x.Transport = transport
+	x.CookieJar = cookieJar
+	x.Learn = learn
+	if caFile != "" {
+		x.Transport.CAFiles = []string{caFile}
+	}
+	if err := x.EnableOracles(oracles); err != nil {
+		panic(err)
+	}
+
+	// Stop gracefully on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	_, err = x.FuzzContext(ctx, restAPI.Options{Guided: guideMode, Budget: budget, Workers: workers, Seed: seed, Minimize: minimize})
+	if err != nil {
+		log.Fatalln(err)
+	}
 }
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	restAPI "github.com/iasthc/hsuan-fuzz/pkg/rest-api"
+)
+
+// triage lists the crash buckets, the most hit first.
+func triage(args []string) {
+
+	fs := flag.NewFlagSet("triage", flag.ExitOnError)
+	o := fs.String("o", ".", "location of `oenapi` specification ")
+	c := fs.String("c", ".", "location of `corpus`")
+	fs.Parse(args)
+
+	x, err := restAPI.New(*o, *c, false, false)
+	if err != nil {
+		panic(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tHITS\tSEVERITY\tORACLE\tCODE\tOPERATION\tPARAMETER\tFIRST\tLAST\tMESSAGE")
+	for _, b := range x.Buckets() {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n", b.ID()[:8], b.Hits, b.Severity, b.Oracle, b.Code, b.Operation, b.Parameter, b.FirstSeen.Format("2006-01-02 15:04:05"), b.LastSeen.Format("2006-01-02 15:04:05"), b.Message)
+	}
+	w.Flush()
+
+}
@@ -8,4 +8,5 @@ require (
 	github.com/valyala/fastjson v1.6.3
 	google.golang.org/protobuf v1.26.0
 	gopkg.in/yaml.v2 v2.3.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -4,6 +4,7 @@ package example
 import (
 	"errors"
 	"fmt"
+	"sort"
 
 	"github.com/getkin/kin-openapi/openapi3"
 )
@@ -335,6 +336,7 @@ func GetBodyExample(mode Mode, mt *openapi3.MediaType) (interface{}, error) {
 		for k := range mt.Examples {
 			keys = append(keys, k)
 		}
+		sort.Strings(keys)
 
 		if len(keys) > 0 {
 			selected := keys[0]
@@ -362,6 +364,7 @@ func GetParameterExample(mode Mode, p *openapi3.Parameter) (interface{}, error)
 		for k := range p.Examples {
 			keys = append(keys, k)
 		}
+		sort.Strings(keys)
 
 		if len(keys) > 0 {
 			selected := keys[0]
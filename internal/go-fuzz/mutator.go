@@ -19,6 +19,11 @@ func NewMutator() *Mutator {
 	return &Mutator{r: New()}
 }
 
+// NewSeededMutator is used to create a reproducible Mutator.
+func NewSeededMutator(seed uint64) *Mutator {
+	return &Mutator{r: NewSeeded(seed)}
+}
+
 func (m *Mutator) rand(n int) int {
 	return m.r.Intn(n)
 }
@@ -5,7 +5,7 @@
 // Package pcg implements a 32 bit PRNG with a 64 bit period: pcg xsh rr 64 32.
 // See https://www.pcg-random.org/ for more information.
 // This implementation is geared specifically towards go-fuzz's needs:
-// Simple creation and use, no reproducibility, no concurrency safety,
+// Simple creation and use, reproducibility only with NewSeeded, no concurrency safety,
 // just the methods go-fuzz needs, optimized for speed.
 package gofuzz
 
@@ -43,6 +43,17 @@ func New() *Rand {
 	return r
 }
 
+// NewSeeded generates a new Rand from seed, the same seed always produces the same sequence.
+func NewSeeded(seed uint64) *Rand {
+	r := new(Rand)
+	r.state = seed
+	r.inc = 1
+	r.step()
+	r.state += seed
+	r.step()
+	return r
+}
+
 func (r *Rand) step() {
 	r.state *= multiplier
 	r.state += r.inc
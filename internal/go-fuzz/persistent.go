@@ -13,10 +13,12 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 )
 
 // PersistentSet is a set of binary blobs with a persistent mirror on disk.
 type PersistentSet struct {
+	mu  sync.Mutex
 	dir string
 	M   map[Sig]Artifact
 }
@@ -70,6 +72,12 @@ func (ps *PersistentSet) readInDir(dir string) {
 		if len(name) > hexLen+1 && isHexString(name[:hexLen]) && name[hexLen] == '.' {
 			return nil // description file
 		}
+		switch filepath.Ext(name) {
+		case ".yml", ".yaml", ".json":
+			return nil // readable seed, converted by the user of PersistentSet
+		case ".go", ".mod":
+			return nil // exported test and its module
+		}
 		var meta uint64
 		if len(name) > hexLen+1 && isHexString(name[:hexLen]) && name[hexLen] == '-' {
 			meta, _ = strconv.ParseUint(name[2*sha1.Size+1:], 10, 64)
@@ -100,6 +108,9 @@ func isHexString(s string) bool {
 
 // Add Artifact to PersistentSet.
 func (ps *PersistentSet) Add(a Artifact) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
 	sig := Hash(a.Data)
 	if _, ok := ps.M[sig]; ok {
 		return false
@@ -114,11 +125,82 @@ func (ps *PersistentSet) Add(a Artifact) bool {
 
 // AddDescription creates a complementary to data file on disk.
 func (ps *PersistentSet) AddDescription(data []byte, desc []byte, typ string) {
+	ps.AddDescriptionSuffix(data, desc, "."+typ)
+}
+
+// AddDescriptionSuffix is the same as AddDescription, but the file name is the hash followed by suffix, e.g. "_test.go".
+func (ps *PersistentSet) AddDescriptionSuffix(data []byte, desc []byte, suffix string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
 	sig := Hash(data)
-	fname := filepath.Join(ps.dir, fmt.Sprintf("%v.%v", hex.EncodeToString(sig[:]), typ))
+	fname := filepath.Join(ps.dir, hex.EncodeToString(sig[:])+suffix)
 	if _, err := os.Stat(fname); os.IsNotExist(err) {
 		if err := ioutil.WriteFile(fname, desc, 0660); err != nil {
 			log.Printf("failed to write file: %v", err)
 		}
 	}
 }
+
+// Flush makes sure every Artifact of PersistentSet is mirrored on disk.
+func (ps *PersistentSet) Flush() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	os.MkdirAll(ps.dir, 0770)
+	for sig, a := range ps.M {
+		if a.user {
+			continue
+		}
+		fname := persistentFilename(ps.dir, a, sig)
+		if _, err := os.Stat(fname); os.IsNotExist(err) {
+			if err := ioutil.WriteFile(fname, a.Data, 0660); err != nil {
+				log.Printf("failed to write file: %v", err)
+			}
+		}
+	}
+}
+
+// SetDescription is the same as AddDescription, but overwrites the existing file.
+func (ps *PersistentSet) SetDescription(data []byte, desc []byte, typ string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	sig := Hash(data)
+	fname := filepath.Join(ps.dir, fmt.Sprintf("%v.%v", hex.EncodeToString(sig[:]), typ))
+	if err := ioutil.WriteFile(fname, desc, 0660); err != nil {
+		log.Printf("failed to write file: %v", err)
+	}
+}
+
+// ReadDescriptions returns the description files of typ by the hex of their data.
+func (ps *PersistentSet) ReadDescriptions(typ string) map[string][]byte {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	res := map[string][]byte{}
+	fnames, err := filepath.Glob(filepath.Join(ps.dir, "*."+typ))
+	if err != nil {
+		log.Printf("error during dir glob: %v\n", err)
+		return res
+	}
+	const hexLen = 2 * sha1.Size
+	for _, fname := range fnames {
+		name := filepath.Base(fname)
+		if len(name) != hexLen+1+len(typ) || !isHexString(name[:hexLen]) {
+			continue
+		}
+		data, err := ioutil.ReadFile(fname)
+		if err != nil {
+			log.Printf("error during file read: %v\n", err)
+			continue
+		}
+		res[name[:hexLen]] = data
+	}
+	return res
+}
+
+// Dir returns the directory of PersistentSet.
+func (ps *PersistentSet) Dir() string {
+	return ps.dir
+}
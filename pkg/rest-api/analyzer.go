@@ -467,6 +467,21 @@ func (x *HsuanFuzz) getCoverageLevels(mapInfos map[uint32][]*ResponseInfo) Cover
 	return cov
 }
 
+// getOperationLabels returns the operations in the order of the coverage levels, e.g. POST /items.
+func (x *HsuanFuzz) getOperationLabels() []string {
+
+	labels := []string{}
+	for _, path := range x.sortedPaths {
+		for _, method := range operationsOrder {
+			if x.openAPI.Paths[path].GetOperation(method) != nil {
+				labels = append(labels, method+" "+path)
+			}
+		}
+	}
+
+	return labels
+}
+
 // func isOverallIncrease(x []int, y []int, print bool) bool {
 // 	a := map[int]int{}
 // 	for _, level := range x {
@@ -0,0 +1,129 @@
+package hsuanfuzz
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/iasthc/hsuan-fuzz/internal/base"
+)
+
+// getAssertion returns the Go statements which fail the exported test while the finding reproduces, and whether they read the body.
+// The statements of a nil finding or an unknown oracle only fail on 5xx, so do the ones of the schema oracle, whose check is left to replay.
+func (x *HsuanFuzz) getAssertion(node *base.Node, f *Finding) (string, bool) {
+
+	oracle := ""
+	if f != nil {
+		oracle = f.Oracle
+	}
+
+	switch oracle {
+
+	case "error-leak":
+		name := strings.TrimSuffix(f.Message, " in response body")
+		if re, ok := errorLeakPatterns[name]; ok {
+			return "\tif regexp.MustCompile(" + strconv.Quote(re.String()) + ").Match(body) {\n\t\tt.Errorf(" + strconv.Quote(f.Message) + ")\n\t}\n", true
+		}
+
+	case "undocumented":
+		if operation := getOperation(x.openAPI, node); operation != nil {
+			return "\tcheckDeclared(t, res, body, " + getGoMap(getDeclaredMediaTypes(operation)) + ")\n", true
+		}
+
+	case "bola":
+		return "\tif res.StatusCode/100 == 2 {\n\t\tt.Errorf(\"status code %d on a resource of another principal\", res.StatusCode)\n\t}\n", false
+
+	case "auth-bypass":
+		return "\tif res.StatusCode != http.StatusUnauthorized && res.StatusCode != http.StatusForbidden {\n\t\tt.Errorf(\"status code %d, want 401 or 403\", res.StatusCode)\n\t}\n", false
+
+	}
+
+	return "\tif res.StatusCode >= 500 {\n\t\tt.Errorf(\"status code %d\", res.StatusCode)\n\t}\n", false
+}
+
+// getGoMap returns the Go literal of the map, the keys are sorted.
+func getGoMap(m map[string]string) string {
+
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	s := "map[string]string{\n"
+	for _, k := range keys {
+		s += "\t\t" + strconv.Quote(k) + ": " + strconv.Quote(m[k]) + ",\n"
+	}
+
+	return s + "\t}"
+}
+
+// getDeclaredMediaTypes returns the comma-separated media types of each declared response of the operation.
+func getDeclaredMediaTypes(operation *openapi3.Operation) map[string]string {
+
+	declared := map[string]string{}
+	for key, ref := range operation.Responses {
+		if ref.Value != nil {
+			declared[key] = strings.Join(getSortedContentTypes(ref.Value.Content), ",")
+		}
+	}
+
+	return declared
+}
+
+// testHelpers is the source of the helpers of the exported tests, it only depends on the standard library.
+const testHelpers = `// Code generated by hsuan-fuzz. DO NOT EDIT.
+
+package crashers
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// getResponseKey returns the declared response of the status code, e.g. 404, 4XX, then default, empty when none.
+func getResponseKey(code int, declared map[string]string) string {
+
+	c := strconv.Itoa(code)
+	for _, key := range []string{c, c[:1] + "XX", c[:1] + "xx", "default"} {
+		if _, ok := declared[key]; ok {
+			return key
+		}
+	}
+
+	return ""
+}
+
+// checkDeclared fails when the status code or the content type of the response is not declared.
+func checkDeclared(t *testing.T, res *http.Response, body []byte, declared map[string]string) {
+
+	t.Helper()
+
+	key := getResponseKey(res.StatusCode, declared)
+	if key == "" {
+		t.Errorf("status code %d is not declared", res.StatusCode)
+		return
+	}
+
+	contentType := res.Header.Get("Content-Type")
+	if len(body) == 0 && contentType == "" {
+		return
+	}
+
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mt = contentType
+	}
+	for _, d := range strings.Split(declared[key], ",") {
+		if d == contentType || d == mt || d == "*/*" || (strings.HasSuffix(d, "/*") && strings.HasPrefix(mt, strings.TrimSuffix(d, "*"))) {
+			return
+		}
+	}
+
+	t.Errorf("content type %q is not declared for status code %d", contentType, res.StatusCode)
+}
+`
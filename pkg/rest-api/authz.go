@@ -0,0 +1,293 @@
+package hsuanfuzz
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// BOLAOracle reports the resources of the owner (the token of Token.yml) which are reached by its other principals.
+// The resources are known from Dependency.yml and the responses of the group, so it only works in strict mode.
+type BOLAOracle struct {
+	x *HsuanFuzz
+}
+
+// NewBOLAOracle returns the broken object level authorization oracle of HsuanFuzz.
+func NewBOLAOracle(x *HsuanFuzz) *BOLAOracle {
+	return &BOLAOracle{x: x}
+}
+
+// Name implements Oracle.
+func (*BOLAOracle) Name() string {
+	return "bola"
+}
+
+// Check implements Oracle, the findings are reported by Probe.
+func (*BOLAOracle) Check(node *Node, req *http.Request, info *ResponseInfo) []*Finding {
+	return nil
+}
+
+// Probe implements ActiveOracle.
+// DELETE is sent as the other principals before the owner, since the resource is gone afterwards.
+// Other methods are sent after the owner has reached the resource.
+func (o *BOLAOracle) Probe(ctx context.Context, node *Node, info *ResponseInfo) []*Probe {
+
+	if !o.x.isOwned(node) {
+		return nil
+	}
+
+	if node.Method == http.MethodDelete {
+		if info != nil {
+			return nil
+		}
+	} else if info == nil || info.Code/100 != 2 {
+		return nil
+	}
+
+	probes := []*Probe{}
+	for i, p := range o.x.Token.Principals {
+
+		if p.Admin || ctx.Err() != nil {
+			continue
+		}
+
+		r := o.x.sendAs(ctx, node, true, p, false)
+		r.principal = getPrincipalName(p, "principal "+strconv.Itoa(i+1))
+		probe := &Probe{Info: r}
+		if r.Code/100 == 2 {
+			probe.Findings = append(probe.Findings, &Finding{
+				Oracle:   o.Name(),
+				Category: "broken-object-level-authorization",
+				Severity: SeverityHigh,
+				Message:  fmt.Sprintf("%s got %d on a resource of %s", r.principal, r.Code, getPrincipalName(&o.x.Token, "owner")),
+			})
+		}
+		probes = append(probes, probe)
+
+	}
+
+	return probes
+}
+
+// isOwned reports whether the node reaches a resource created in its group, by a source path of Dependency.yml.
+func (x *HsuanFuzz) isOwned(node *Node) bool {
+
+	if !x.strictMode || x.dependency.Paths[node.Path] == nil {
+		return false
+	}
+
+	for _, item := range x.dependency.Paths[node.Path].Items {
+		if item.Source == nil || item.Source.Path == "x" {
+			continue
+		}
+		if _, ok := x.getGroupInfo(node.Group, item.Source.Path); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getPrincipalName(t *Token, name string) string {
+
+	if t.Name != "" {
+		return t.Name
+	}
+
+	return name
+}
+
+// getPrincipal returns the principal of the name which sent the node, a principal of Token.yml or a credential of the auth bypass oracle.
+// The empty name is the owner.
+func (x *HsuanFuzz) getPrincipal(node *Node, name string) (*Token, bool) {
+
+	if name == "" {
+		return &x.Token, true
+	}
+
+	for i, p := range x.Token.Principals {
+		if getPrincipalName(p, "principal "+strconv.Itoa(i+1)) == name {
+			return p, true
+		}
+	}
+
+	if schemes := getSecuritySchemes(x.openAPI, getOperation(x.openAPI, node)); len(schemes) > 0 {
+		for _, c := range x.getOwnerBypassCredentials(schemes[0]) {
+			if c.name == name {
+				return c.token, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// AuthBypassOracle re-sends the successful requests of secured operations with missing, expired, garbage or misplaced credentials.
+// A 2xx response means the security requirement of the operation is not enforced.
+type AuthBypassOracle struct {
+	x *HsuanFuzz
+}
+
+// NewAuthBypassOracle returns the authentication bypass oracle of HsuanFuzz.
+func NewAuthBypassOracle(x *HsuanFuzz) *AuthBypassOracle {
+	return &AuthBypassOracle{x: x}
+}
+
+// Name implements Oracle.
+func (*AuthBypassOracle) Name() string {
+	return "auth-bypass"
+}
+
+// Check implements Oracle, the findings are reported by Probe.
+func (*AuthBypassOracle) Check(node *Node, req *http.Request, info *ResponseInfo) []*Finding {
+	return nil
+}
+
+// Probe implements ActiveOracle.
+func (o *AuthBypassOracle) Probe(ctx context.Context, node *Node, info *ResponseInfo) []*Probe {
+
+	if info == nil || info.Code/100 != 2 {
+		return nil
+	}
+
+	schemes := getSecuritySchemes(o.x.openAPI, getOperation(o.x.openAPI, node))
+	if len(schemes) == 0 {
+		return nil
+	}
+
+	probes := []*Probe{}
+	for _, c := range o.x.getOwnerBypassCredentials(schemes[0]) {
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		r := o.x.sendAs(ctx, node, true, c.token, false)
+		r.principal = c.name
+		probe := &Probe{Info: r}
+		if r.Code/100 == 2 {
+			probe.Findings = append(probe.Findings, &Finding{
+				Oracle:   o.Name(),
+				Category: "authentication-bypass",
+				Severity: c.severity,
+				Message:  fmt.Sprintf("%s got %d, %s is skipped", c.name, r.Code, strings.Join(schemes, " or ")),
+			})
+		}
+		probes = append(probes, probe)
+
+	}
+
+	return probes
+}
+
+// getSecuritySchemes returns the names of the security schemes the operation requires, the operation overrides the specification.
+// It is empty when the operation is public, including an empty requirement which makes the others optional.
+func getSecuritySchemes(openAPI *openapi3.Swagger, operation *openapi3.Operation) []string {
+
+	if operation == nil {
+		return nil
+	}
+
+	requirements := openAPI.Security
+	if operation.Security != nil {
+		requirements = *operation.Security
+	}
+
+	names := map[string]bool{}
+	for _, requirement := range requirements {
+		if len(requirement) == 0 {
+			return nil
+		}
+		for name := range requirement {
+			names[name] = true
+		}
+	}
+
+	schemes := []string{}
+	for name := range names {
+		schemes = append(schemes, name)
+	}
+	sort.Strings(schemes)
+
+	return schemes
+}
+
+// bypassCredential is a credential which must be rejected by a secured operation.
+type bypassCredential struct {
+	name     string
+	token    *Token
+	severity Severity
+}
+
+// getBypassCredentials returns the credentials derived from the token of the owner, in is where the credential is sent.
+// The caller holds tokenMu.
+func getBypassCredentials(t *Token, in string) []*bypassCredential {
+
+	credentials := []*bypassCredential{
+		{name: "no credentials", token: &Token{}, severity: SeverityCritical},
+		{name: "garbage token", token: &Token{Bearer: "hsuanfuzz.invalid.token", In: t.In}, severity: SeverityCritical},
+	}
+
+	if expired := getExpiredJWT(t.Bearer); expired != "" {
+		credentials = append(credentials, &bypassCredential{name: "expired token", token: &Token{Bearer: expired, In: t.In}, severity: SeverityHigh})
+	}
+
+	if t.In != "" {
+		in = t.In
+	}
+	if t.Bearer != "" || len(t.Schemes) > 0 {
+		wrong := "query"
+		if in == "query" {
+			wrong = "header"
+		}
+		credentials = append(credentials, &bypassCredential{name: "token in " + wrong, token: &Token{Bearer: t.Bearer, In: wrong, Schemes: t.Schemes}, severity: SeverityMedium})
+	}
+
+	return credentials
+}
+
+// getOwnerBypassCredentials returns the bypass credentials of the owner for the security scheme, the token is refreshed by other requests meanwhile.
+func (x *HsuanFuzz) getOwnerBypassCredentials(scheme string) []*bypassCredential {
+
+	x.tokenMu.RLock()
+	defer x.tokenMu.RUnlock()
+
+	return getBypassCredentials(&x.Token, x.getCredentialLocation(scheme))
+}
+
+// getExpiredJWT returns the JWT with an expiration time in the past, the signature is kept and no longer valid.
+// It is empty when the token is not a JWT.
+func getExpiredJWT(token string) string {
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ""
+	}
+
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return ""
+	}
+	claims["exp"] = 1
+	claims["iat"] = 0
+
+	b, err = json.Marshal(claims)
+	if err != nil {
+		return ""
+	}
+	parts[1] = base64.RawURLEncoding.EncodeToString(b)
+
+	return strings.Join(parts, ".")
+}
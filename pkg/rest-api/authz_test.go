@@ -0,0 +1,65 @@
+package hsuanfuzz
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestAuthBypassProbeRefreshedToken(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	x := newTestCampaign(t, server.URL, `
+components: {securitySchemes: {bearer: {type: http, scheme: bearer}}}
+security: [{bearer: []}]
+paths:
+  /items:
+    get: {responses: {"200": {description: ok}, "401": {description: unauthorized}}}
+`)
+	x.Token.Bearer = "owner"
+	if err := x.initClient(); err != nil {
+		t.Fatal(err)
+	}
+	o := NewAuthBypassOracle(x)
+
+	// The token is refreshed by other requests while the probes derive their credentials from it, see go test -race
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			x.tokenMu.Lock()
+			x.Token.Bearer = "owner" + strconv.Itoa(i)
+			x.tokenMu.Unlock()
+		}
+	}()
+
+	node := &Node{Group: 1, Path: "/items", Method: http.MethodGet}
+	for i := 0; i < 10; i++ {
+		for _, p := range o.Probe(context.Background(), node, &ResponseInfo{Code: 200}) {
+			if len(p.Findings) > 0 {
+				t.Errorf("got the findings %v of a rejected credential", p.Findings)
+			}
+		}
+		if _, ok := x.getPrincipal(node, "token in query"); !ok {
+			t.Error("the credential in the query is not a principal")
+		}
+	}
+
+	close(done)
+	wg.Wait()
+
+}
@@ -0,0 +1,87 @@
+package hsuanfuzz
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Budget limits a fuzzing campaign, zero values mean unlimited.
+type Budget struct {
+	Iterations  int
+	Duration    time.Duration
+	Requests    int
+	StopOnCrash bool
+	Plateau     int // stop when endCov has not increased for N iterations
+}
+
+// Summary presents the result of a fuzzing campaign.
+type Summary struct {
+	Iterations int      `yaml:"iterations"`
+	Requests   int      `yaml:"requests"`
+	Crashers   int      `yaml:"crashers"`
+	Throttled  int      `yaml:"throttled"`
+	Timeouts   int      `yaml:"timeouts"`
+	Coverage   Coverage `yaml:"coverage"`
+	Reason     string   `yaml:"reason"`
+}
+
+func (s *Summary) String() string {
+	return fmt.Sprintf("iterations: %d, requests: %d, crashers: %d, throttled: %d, timeouts: %d, reason: %s, coverage: %s", s.Iterations, s.Requests, s.Crashers, s.Throttled, s.Timeouts, s.Reason, s.Coverage.String())
+}
+
+// campaign records the progress of Fuzz and is compared with the budget.
+type campaign struct {
+	mu         sync.Mutex
+	start      time.Time
+	iterations int
+	requests   int
+	crashers   map[string]bool
+	throttled  int
+	timeouts   int
+	plateau    int
+	stop       context.CancelFunc // stops the requests of the campaign, e.g. on the first crasher
+}
+
+func newCampaign() *campaign {
+	return &campaign{start: time.Now(), crashers: map[string]bool{}, stop: func() {}}
+}
+
+// exhausted returns the reason for stopping, or an empty string if the campaign can continue.
+func (b *Budget) exhausted(c *campaign) string {
+
+	if b.Iterations > 0 && c.iterations >= b.Iterations {
+		return "iterations"
+	}
+
+	if b.Duration > 0 && time.Since(c.start) >= b.Duration {
+		return "duration"
+	}
+
+	if b.Requests > 0 && c.requests >= b.Requests {
+		return "requests"
+	}
+
+	if b.StopOnCrash && len(c.crashers) > 0 {
+		return "crasher"
+	}
+
+	if b.Plateau > 0 && c.plateau >= b.Plateau {
+		return "plateau"
+	}
+
+	return ""
+}
+
+func (c *campaign) summary(cov Coverage, reason string) *Summary {
+	return &Summary{
+		Iterations: c.iterations,
+		Requests:   c.requests,
+		Crashers:   len(c.crashers),
+		Throttled:  c.throttled,
+		Timeouts:   c.timeouts,
+		Coverage:   Coverage{Levels: append([]int{}, cov.Levels...)},
+		Reason:     reason,
+	}
+}
@@ -0,0 +1,182 @@
+package hsuanfuzz
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+var defineFormats sync.Once
+
+// getOperation returns the operation of the node in the specification.
+func getOperation(openAPI *openapi3.Swagger, node *Node) *openapi3.Operation {
+
+	pathItem := openAPI.Paths[node.Path]
+	if pathItem == nil {
+		return nil
+	}
+
+	return pathItem.GetOperation(node.Method)
+}
+
+// getResponse returns the declared response of the status code, e.g. 404, 4XX, then default.
+func getResponse(operation *openapi3.Operation, code int) *openapi3.Response {
+
+	c := strconv.Itoa(code)
+	for _, key := range []string{c, c[:1] + "XX", c[:1] + "xx", "default"} {
+		if ref, ok := operation.Responses[key]; ok && ref.Value != nil {
+			return ref.Value
+		}
+	}
+
+	return nil
+}
+
+// SchemaOracle reports responses which do not conform to the declared schema of the status code and content type.
+type SchemaOracle struct {
+	openAPI *openapi3.Swagger
+}
+
+// NewSchemaOracle creates a SchemaOracle of the specification.
+func NewSchemaOracle(openAPI *openapi3.Swagger) *SchemaOracle {
+
+	defineFormats.Do(func() {
+		if _, ok := openapi3.SchemaStringFormats["uuid"]; !ok {
+			openapi3.DefineStringFormat("uuid", "(?i)"+openapi3.FormatOfStringForUUIDOfRFC4122)
+		}
+		openapi3.DefineIPv4Format()
+		openapi3.DefineIPv6Format()
+	})
+
+	return &SchemaOracle{openAPI: openAPI}
+}
+
+// Name implements Oracle.
+func (*SchemaOracle) Name() string {
+	return "schema"
+}
+
+// Check implements Oracle.
+func (o *SchemaOracle) Check(node *Node, req *http.Request, info *ResponseInfo) []*Finding {
+
+	if info.Code == 0 || info.Code == 599 {
+		return nil
+	}
+
+	operation := getOperation(o.openAPI, node)
+	if operation == nil {
+		return nil
+	}
+
+	response := getResponse(operation, info.Code)
+	if response == nil {
+		return nil
+	}
+
+	mt := response.Content.Get(info.Type)
+	if mt == nil || mt.Schema == nil || mt.Schema.Value == nil || !strings.Contains(strings.ToLower(info.Type), "json") {
+		return nil
+	}
+
+	var body interface{}
+	if err := json.Unmarshal([]byte(info.Body), &body); err != nil {
+		return []*Finding{{Oracle: o.Name(), Category: "contract", Severity: SeverityLow, Message: "/: invalid JSON, " + err.Error()}}
+	}
+
+	err := mt.Schema.Value.VisitJSON(body, openapi3.MultiErrors(), openapi3.VisitAsResponse())
+	if err == nil {
+		return nil
+	}
+
+	violations := flattenSchemaErrors(err)
+	sort.Strings(violations)
+
+	findings := []*Finding{}
+	for _, e := range violations {
+		findings = append(findings, &Finding{Oracle: o.Name(), Category: "contract", Severity: SeverityLow, Message: e})
+	}
+
+	return findings
+}
+
+// flattenSchemaErrors returns each violation as "JSON pointer: reason".
+func flattenSchemaErrors(err error) []string {
+
+	var me openapi3.MultiError
+	if errors.As(err, &me) {
+		res := []string{}
+		for _, e := range me {
+			res = append(res, flattenSchemaErrors(e)...)
+		}
+		return res
+	}
+
+	var se *openapi3.SchemaError
+	if errors.As(err, &se) {
+
+		tokens := []string{}
+		for _, token := range se.JSONPointer() {
+			tokens = append(tokens, strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1"))
+		}
+		pointer := "/" + strings.Join(tokens, "/")
+
+		reason := se.Reason
+		if reason == "" {
+			reason = "doesn't match schema \"" + se.SchemaField + "\""
+		}
+
+		return []string{pointer + ": " + reason}
+	}
+
+	return []string{"/: " + err.Error()}
+}
+
+// UndocumentedOracle reports status codes and content types which are not declared by the operation.
+type UndocumentedOracle struct {
+	openAPI *openapi3.Swagger
+}
+
+// NewUndocumentedOracle creates an UndocumentedOracle of the specification.
+func NewUndocumentedOracle(openAPI *openapi3.Swagger) *UndocumentedOracle {
+	return &UndocumentedOracle{openAPI: openAPI}
+}
+
+// Name implements Oracle.
+func (*UndocumentedOracle) Name() string {
+	return "undocumented"
+}
+
+// Check implements Oracle.
+func (o *UndocumentedOracle) Check(node *Node, req *http.Request, info *ResponseInfo) []*Finding {
+
+	if info.Code == 0 || info.Code == 599 {
+		return nil
+	}
+
+	operation := getOperation(o.openAPI, node)
+	if operation == nil {
+		return nil
+	}
+
+	response := getResponse(operation, info.Code)
+	if response == nil {
+		return []*Finding{{Oracle: o.Name(), Category: "undocumented-status", Severity: SeverityLow, Message: "status code " + strconv.Itoa(info.Code) + " is not declared"}}
+	}
+
+	// An empty body has no content type to declare
+	if info.Body == "" && info.Type == "" {
+		return nil
+	}
+
+	if response.Content.Get(info.Type) == nil {
+		return []*Finding{{Oracle: o.Name(), Category: "undocumented-content-type", Severity: SeverityLow, Message: "content type \"" + info.Type + "\" is not declared for status code " + strconv.Itoa(info.Code)}}
+	}
+
+	return nil
+}
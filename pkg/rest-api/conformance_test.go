@@ -0,0 +1,112 @@
+package hsuanfuzz
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testConformanceSpec = `
+openapi: 3.0.0
+info: {title: Test, version: "1"}
+servers: [{url: "http://api.local"}]
+paths:
+  /items/{itemId}:
+    get:
+      parameters: [{name: itemId, in: path, required: true, schema: {type: string}}]
+      responses:
+        "200":
+          description: ok
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [id]
+                properties:
+                  id: {type: string, format: uuid}
+                  count: {type: integer, minimum: 0}
+                  tags: {type: array, items: {type: string}}
+        4XX: {description: client error}
+        "500": {description: error, content: {text/plain: {schema: {type: string}}}}
+`
+
+// checkOracle returns the categories and messages of the findings of the oracle for GET /items/{itemId}.
+func checkOracle(o Oracle, info *ResponseInfo) []string {
+
+	res := []string{}
+	for _, f := range o.Check(&Node{Path: "/items/{itemId}", Method: "GET"}, nil, info) {
+		res = append(res, f.Category+": "+f.Message)
+	}
+
+	return res
+}
+
+func TestSchemaOracle(t *testing.T) {
+
+	x := newTestFuzz(t, testConformanceSpec)
+	o := NewSchemaOracle(x.openAPI)
+
+	tests := []struct {
+		name string
+		info *ResponseInfo
+		want []string
+	}{
+		{"clean", &ResponseInfo{Code: 200, Type: "application/json", Body: `{"id":"7f1c2a3b-0000-4a4a-8b8b-0123456789ab","count":1,"tags":["a"]}`}, []string{}},
+		{"charset of the content type", &ResponseInfo{Code: 200, Type: "application/json; charset=utf-8", Body: `{"id":"7f1c2a3b-0000-4a4a-8b8b-0123456789ab"}`}, []string{}},
+		{"wrong types", &ResponseInfo{Code: 200, Type: "application/json", Body: `{"id":"7f1c2a3b-0000-4a4a-8b8b-0123456789ab","count":"1","tags":[2]}`}, []string{
+			`contract: /count: Field must be set to integer or not be present`,
+			`contract: /tags/0: Field must be set to string or not be present`,
+		}},
+		{"missing required property", &ResponseInfo{Code: 200, Type: "application/json", Body: `{"count":-1}`}, []string{
+			`contract: /count: number must be at least 0`,
+			`contract: /id: property "id" is missing`,
+		}},
+		{"invalid format", &ResponseInfo{Code: 200, Type: "application/json", Body: `{"id":"nope"}`}, []string{
+			`contract: /id: string doesn't match the format "uuid" (regular expression "(?i)^[0-9a-f]{8}-[0-9a-f]{4}-[1-5][0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$")`,
+		}},
+		{"invalid JSON", &ResponseInfo{Code: 200, Type: "application/json", Body: `{"id":`}, []string{`contract: /: invalid JSON, unexpected end of JSON input`}},
+		{"no schema of the status code", &ResponseInfo{Code: 404, Type: "application/json", Body: `{"error":1}`}, []string{}},
+		{"not JSON", &ResponseInfo{Code: 500, Type: "text/plain", Body: "oops"}, []string{}},
+		{"undocumented status code", &ResponseInfo{Code: 302}, []string{}},
+		{"no response", &ResponseInfo{Code: 599, Body: "connection refused"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkOracle(o, tt.info); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestUndocumentedOracle(t *testing.T) {
+
+	x := newTestFuzz(t, testConformanceSpec)
+	o := NewUndocumentedOracle(x.openAPI)
+
+	tests := []struct {
+		name string
+		info *ResponseInfo
+		want []string
+	}{
+		{"clean", &ResponseInfo{Code: 200, Type: "application/json", Body: `{}`}, []string{}},
+		{"range of status codes", &ResponseInfo{Code: 404, Body: ""}, []string{}},
+		{"empty body", &ResponseInfo{Code: 500}, []string{}},
+		{"undocumented status code", &ResponseInfo{Code: 302, Type: "text/html", Body: "moved"}, []string{`undocumented-status: status code 302 is not declared`}},
+		{"undocumented server error", &ResponseInfo{Code: 503}, []string{`undocumented-status: status code 503 is not declared`}},
+		{"undocumented content type", &ResponseInfo{Code: 200, Type: "text/html", Body: "<p>"}, []string{`undocumented-content-type: content type "text/html" is not declared for status code 200`}},
+		{"content type of a response without content", &ResponseInfo{Code: 400, Type: "application/json", Body: `{}`}, []string{`undocumented-content-type: content type "application/json" is not declared for status code 400`}},
+		{"no response", &ResponseInfo{Code: 599, Body: "connection refused"}, []string{}},
+		{"timeout", &ResponseInfo{Timeout: true}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkOracle(o, tt.info); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+}
@@ -0,0 +1,248 @@
+package hsuanfuzz
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/iasthc/hsuan-fuzz/internal/base"
+	"google.golang.org/protobuf/proto"
+)
+
+// getRequestParts returns the sorted headers and the body of the request.
+func getRequestParts(req *http.Request) ([]string, string, error) {
+
+	keys := []string{}
+	for k := range req.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	body := ""
+	if req.GetBody != nil {
+		r, err := req.GetBody()
+		if err != nil {
+			return nil, "", err
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, "", err
+		}
+		body = string(b)
+	}
+
+	return keys, body, nil
+}
+
+func quoteShell(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// ExportCurl returns a shell script which sends the same request as SendRequest.
+func (x *HsuanFuzz) ExportCurl(node *base.Node) (string, error) {
+
+	req, err := x.NewRequest(context.Background(), node, true)
+	if err != nil {
+		return "", err
+	}
+
+	return getCurl(req)
+}
+
+func getCurl(req *http.Request) (string, error) {
+
+	keys, body, err := getRequestParts(req)
+	if err != nil {
+		return "", err
+	}
+
+	script := "#!/bin/sh\n"
+	script += "curl -i -X " + req.Method + " " + quoteShell(req.URL.String())
+	for _, k := range keys {
+		for _, v := range req.Header[k] {
+			script += " \\\n  -H " + quoteShell(k+": "+v)
+		}
+	}
+	if body != "" {
+		script += " \\\n  --data-binary " + quoteShell(body)
+	}
+	script += "\n"
+
+	return script, nil
+}
+
+// ExportGoTest returns a Go test which sends the same request as SendRequest, and fails while the finding reproduces.
+// The assertion is of the oracle of the finding, e.g. the declared status codes, and only fails on 5xx when f is nil.
+func (x *HsuanFuzz) ExportGoTest(node *base.Node, name string, f *Finding) (string, error) {
+
+	req, err := x.NewRequest(context.Background(), node, true)
+	if err != nil {
+		return "", err
+	}
+
+	return x.getGoTest(req, node, name, f)
+}
+
+// getGoTest returns the Go test of the request.
+func (x *HsuanFuzz) getGoTest(req *http.Request, node *base.Node, name string, f *Finding) (string, error) {
+
+	keys, body, err := getRequestParts(req)
+	if err != nil {
+		return "", err
+	}
+
+	assertion, read := x.getAssertion(node, f)
+
+	imports := []string{"net/http", "strings", "testing"}
+	if read {
+		imports = append(imports, "io/ioutil")
+	}
+	if strings.Contains(assertion, "regexp.") {
+		imports = append(imports, "regexp")
+	}
+	sort.Strings(imports)
+
+	test := "package crashers\n\n"
+	test += "import (\n"
+	for _, i := range imports {
+		test += "\t" + strconv.Quote(i) + "\n"
+	}
+	test += ")\n\n"
+	test += "// Test" + name + " replays " + node.Method + " " + node.Path + ".\n"
+	test += "func Test" + name + "(t *testing.T) {\n\n"
+	test += "\treq, err := http.NewRequest(" + strconv.Quote(req.Method) + ", " + strconv.Quote(req.URL.String()) + ", strings.NewReader(" + strconv.Quote(body) + "))\n"
+	test += "\tif err != nil {\n\t\tt.Fatal(err)\n\t}\n\n"
+	for _, k := range keys {
+		for _, v := range req.Header[k] {
+			test += "\treq.Header.Add(" + strconv.Quote(k) + ", " + strconv.Quote(v) + ")\n"
+		}
+	}
+	test += "\n\tres, err := http.DefaultClient.Do(req)\n"
+	test += "\tif err != nil {\n\t\tt.Fatal(err)\n\t}\n"
+	test += "\tdefer res.Body.Close()\n\n"
+	if read {
+		test += "\tbody, err := ioutil.ReadAll(res.Body)\n"
+		test += "\tif err != nil {\n\t\tt.Fatal(err)\n\t}\n\n"
+	}
+	test += assertion + "\n"
+	test += "}\n"
+
+	return test, nil
+}
+
+// saveExports writes the curl script and the Go test of the crasher next to its node, with the request which got the response.
+func (x *HsuanFuzz) saveExports(name string, node *base.Node, info *ResponseInfo, f *Finding) {
+
+	sig := Bucket{Signature: name}
+	id := sig.ID()
+
+	req := info.raw
+	if req == nil {
+		var err error
+		if req, err = x.NewRequest(context.Background(), node, true); err != nil {
+			return
+		}
+	}
+
+	curl, err := getCurl(req)
+	if err != nil {
+		return
+	}
+	test, err := x.getGoTest(req, node, "Crasher"+id[:8], f)
+	if err != nil {
+		return
+	}
+
+	x.crashers.AddDescription([]byte(name), []byte(curl), "curl")
+	x.crashers.AddDescriptionSuffix([]byte(name), []byte(test), "_test.go")
+
+	if err := writeTestModule(x.crashers.Dir()); err != nil {
+		log.Println(err)
+	}
+
+}
+
+// writeTestModule makes the directory a module with the helpers of the exported tests, so they run with go test.
+func writeTestModule(dir string) error {
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "helpers_test.go"), []byte(testHelpers), 0660); err != nil {
+		return err
+	}
+
+	p := filepath.Join(dir, "go.mod")
+	if _, err := os.Stat(p); err == nil {
+		return nil
+	}
+
+	return ioutil.WriteFile(p, []byte("module crashers\n\ngo 1.16\n"), 0660)
+}
+
+// ExportDir writes the curl script and the Go test of every crasher (.node) in the directory, and returns the number of crashers.
+func (x *HsuanFuzz) ExportDir(dir string) (int, error) {
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.node"))
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return 0, err
+		}
+
+		node := base.Node{}
+		if err := proto.Unmarshal(b, &node); err != nil {
+			return 0, err
+		}
+
+		prefix := strings.TrimSuffix(file, ".node")
+		id := filepath.Base(prefix)
+
+		// Probes of active oracles are sent as another principal
+		principal, _ := ioutil.ReadFile(prefix + ".principal")
+		t, ok := x.getPrincipal(&node, string(principal))
+		if !ok {
+			log.Println("unknown principal " + string(principal) + " of " + file)
+			continue
+		}
+
+		req, err := x.newRequest(context.Background(), &node, true, t)
+		if err != nil {
+			return 0, err
+		}
+
+		curl, err := getCurl(req)
+		if err != nil {
+			return 0, err
+		}
+		if err := ioutil.WriteFile(prefix+".curl", []byte(curl), 0660); err != nil {
+			return 0, err
+		}
+
+		test, err := x.getGoTest(req, &node, "Crasher"+id[:8], readFinding(prefix))
+		if err != nil {
+			return 0, err
+		}
+		if err := ioutil.WriteFile(prefix+"_test.go", []byte(test), 0660); err != nil {
+			return 0, err
+		}
+
+	}
+
+	if len(files) > 0 {
+		if err := writeTestModule(dir); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(files), nil
+}
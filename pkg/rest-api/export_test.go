@@ -0,0 +1,62 @@
+package hsuanfuzz
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gofuzz "github.com/iasthc/hsuan-fuzz/internal/go-fuzz"
+)
+
+func TestExportDir(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	x := newTestCampaign(t, server.URL, testItemsPaths)
+	x.Oracles = []Oracle{ServerErrorOracle{}}
+
+	node := newTestNode(t, "/items", http.MethodPost, "application/json", map[string]interface{}{"name": "app"})
+	info, findings := x.sendChecked(context.Background(), node)
+	if len(findings) != 1 {
+		t.Fatalf("got the findings %v of %d, want one", findings, info.Code)
+	}
+	name, _ := x.saveCrasher(node, info, findings[0])
+
+	// The script is written again by the export
+	dir := x.CrashersDir()
+	prefix := filepath.Join(dir, (&Bucket{Signature: name}).ID())
+	if err := os.Remove(prefix + ".curl"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := x.ExportDir(dir); err != nil || n != 1 {
+		t.Fatalf("got %d crashers and the error %v, want one", n, err)
+	}
+
+	for _, p := range []string{prefix + ".curl", prefix + "_test.go", filepath.Join(dir, "helpers_test.go"), filepath.Join(dir, "go.mod")} {
+		if _, err := os.Stat(p); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// The script of the export has the mode of the files of the campaign
+	curl, err := os.Stat(prefix + ".curl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node, err := os.Stat(prefix + ".node"); err != nil || curl.Mode() != node.Mode() {
+		t.Errorf("got the mode %v of the curl script, want the one of the node", curl.Mode())
+	}
+
+	// The exports are not loaded back as crashers
+	if m := gofuzz.NewPersistentSet(dir).M; len(m) != 0 {
+		t.Errorf("got %d artifacts in the crashers", len(m))
+	}
+
+}
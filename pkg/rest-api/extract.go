@@ -0,0 +1,494 @@
+package hsuanfuzz
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fastjson"
+)
+
+// Keys of Token.yml and Dependency.yml select a value of a response, in one of these forms:
+//
+//	/data/id                              JSON Pointer (RFC 6901), #/data/id is its percent-encoded fragment form
+//	$.items[?(@.status=='active')].id     JSONPath, see compileJSONPath for the subset
+//	$response.body#/data/id               runtime expressions of OpenAPI links
+//	$response.header.Location             the last segment of the path of Location is the id
+//	data{id}, data[{id}]                  the former syntax, an array is its first element
+//
+// When several values are selected, e.g. by a wildcard or a filter, one of them is picked at random.
+
+// Steps of a compiled key.
+const (
+	stepName = iota
+	stepIndex
+	stepWildcard
+	stepFilter
+)
+
+type keyStep struct {
+	kind   int
+	name   string
+	index  int
+	filter *keyFilter
+}
+
+// keyFilter is the expression of [?(@.status=='active')], a comparison of a key of the element or its existence.
+type keyFilter struct {
+	keys  []string
+	op    string // empty for the existence
+	value *fastjson.Value
+}
+
+// responseKey is a compiled key.
+type responseKey struct {
+	header string // name of the header, otherwise the key selects the body
+	steps  []*keyStep
+}
+
+// compileKey parses the key in any of its forms.
+func compileKey(key string) (*responseKey, error) {
+
+	switch {
+
+	case strings.HasPrefix(key, "$response.header."):
+		name := strings.TrimPrefix(key, "$response.header.")
+		if name == "" {
+			return nil, errors.New("no header name of " + key)
+		}
+		return &responseKey{header: name}, nil
+
+	case strings.HasPrefix(key, "$response.body"):
+		rest := strings.TrimPrefix(key, "$response.body")
+		if rest != "" && !strings.HasPrefix(rest, "#") {
+			return nil, errors.New("invalid runtime expression " + key)
+		}
+		return compileJSONPointer(strings.TrimPrefix(rest, "#"), rest != "")
+
+	case strings.HasPrefix(key, "$"):
+		return compileJSONPath(key)
+
+	case strings.HasPrefix(key, "/"):
+		return compileJSONPointer(key, false)
+
+	case strings.HasPrefix(key, "#"):
+		return compileJSONPointer(strings.TrimPrefix(key, "#"), true)
+
+	}
+
+	// The former syntax
+	steps := []*keyStep{}
+	for _, k := range parseKey(key) {
+		steps = append(steps, &keyStep{kind: stepName, name: k})
+	}
+
+	return &responseKey{steps: steps}, nil
+}
+
+// compileJSONPointer parses the JSON Pointer, the empty one is the whole document.
+// The tokens of the URI fragment form, e.g. #/a%20b, are percent-encoded, the ones of the plain form are not.
+func compileJSONPointer(pointer string, fragment bool) (*responseKey, error) {
+
+	if pointer == "" {
+		return &responseKey{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errors.New("invalid JSON Pointer " + pointer)
+	}
+
+	steps := []*keyStep{}
+	for _, token := range strings.Split(pointer[1:], "/") {
+		if fragment {
+			s, err := url.PathUnescape(token)
+			if err != nil {
+				return nil, errors.New("invalid JSON Pointer " + pointer + ": " + err.Error())
+			}
+			token = s
+		}
+		steps = append(steps, &keyStep{kind: stepName, name: strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")})
+	}
+
+	return &responseKey{steps: steps}, nil
+}
+
+// compileJSONPath parses the subset of JSONPath:
+// $.name, $['name'], $.*, $[*], $[0], $[-1], $[?(@.name)] and $[?(@.name op value)] where op is ==, !=, <, <=, > or >=,
+// and value is a quoted string, number, true, false or null.
+func compileJSONPath(path string) (*responseKey, error) {
+
+	invalid := func(reason string) error {
+		return errors.New("invalid JSONPath " + path + ": " + reason)
+	}
+
+	steps := []*keyStep{}
+	s := strings.TrimPrefix(path, "$")
+	for len(s) > 0 {
+
+		switch {
+
+		case strings.HasPrefix(s, ".."):
+			return nil, invalid("recursive descent is not supported")
+
+		case s[0] == '.':
+
+			s = s[1:]
+			if strings.HasPrefix(s, "*") {
+				steps = append(steps, &keyStep{kind: stepWildcard})
+				s = s[1:]
+				continue
+			}
+
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, invalid("empty name")
+			}
+			steps = append(steps, &keyStep{kind: stepName, name: s[:end]})
+			s = s[end:]
+
+		case s[0] == '[':
+
+			end := findBracket(s)
+			if end < 0 {
+				return nil, invalid("unclosed bracket")
+			}
+			inner := strings.TrimSpace(s[1:end])
+			s = s[end+1:]
+
+			switch {
+
+			case inner == "*":
+				steps = append(steps, &keyStep{kind: stepWildcard})
+
+			case strings.HasPrefix(inner, "?(") && strings.HasSuffix(inner, ")"):
+				filter, err := compileFilter(strings.TrimSpace(inner[2 : len(inner)-1]))
+				if err != nil {
+					return nil, invalid(err.Error())
+				}
+				steps = append(steps, &keyStep{kind: stepFilter, filter: filter})
+
+			case strings.HasPrefix(inner, "'") || strings.HasPrefix(inner, `"`):
+				name, err := unquote(inner)
+				if err != nil {
+					return nil, invalid(err.Error())
+				}
+				steps = append(steps, &keyStep{kind: stepName, name: name})
+
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, invalid("unsupported selector " + inner)
+				}
+				steps = append(steps, &keyStep{kind: stepIndex, index: index})
+
+			}
+
+		default:
+			return nil, invalid("unexpected " + s)
+
+		}
+
+	}
+
+	return &responseKey{steps: steps}, nil
+}
+
+// findBracket returns the index of the bracket closing s[0], the brackets in quotes are skipped.
+func findBracket(s string) int {
+
+	depth := 0
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+
+	}
+
+	return -1
+}
+
+// unquote converts 'name' or "name" to name.
+func unquote(s string) (string, error) {
+
+	if len(s) < 2 || s[0] != s[len(s)-1] {
+		return "", errors.New("unclosed quote " + s)
+	}
+
+	// Single quotes are not JSON
+	inner := strings.ReplaceAll(s[1:len(s)-1], `\'`, `'`)
+	if s[0] == '\'' {
+		inner = strings.ReplaceAll(inner, `"`, `\"`)
+	}
+
+	name := ""
+	if err := json.Unmarshal([]byte(`"`+inner+`"`), &name); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// compileFilter parses @.status=='active' or @.status.
+func compileFilter(expression string) (*keyFilter, error) {
+
+	if !strings.HasPrefix(expression, "@") {
+		return nil, errors.New("filter must start with @")
+	}
+
+	// The first operator, the value may have one in quotes
+	op := ""
+	left, right := expression, ""
+	first := len(expression)
+	for _, o := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if i := strings.Index(expression, o); i >= 0 && i < first {
+			first, op = i, o
+			left, right = strings.TrimSpace(expression[:i]), strings.TrimSpace(expression[i+len(o):])
+		}
+	}
+
+	filter := &keyFilter{op: op}
+	for _, k := range strings.Split(strings.TrimPrefix(left, "@"), ".") {
+		if k != "" {
+			filter.keys = append(filter.keys, k)
+		}
+	}
+
+	if op == "" {
+		return filter, nil
+	}
+
+	if strings.HasPrefix(right, "'") || strings.HasPrefix(right, `"`) {
+		s, err := unquote(right)
+		if err != nil {
+			return nil, err
+		}
+		b, err := json.Marshal(s)
+		if err != nil {
+			return nil, err
+		}
+		right = string(b)
+	}
+
+	value, err := fastjson.Parse(right)
+	if err != nil {
+		return nil, errors.New("invalid value " + right)
+	}
+	filter.value = value
+
+	return filter, nil
+}
+
+// match reports whether the element satisfies the filter.
+func (f *keyFilter) match(v *fastjson.Value) bool {
+
+	target := v.Get(f.keys...)
+	if f.op == "" {
+		return target != nil && target.Type() != fastjson.TypeFalse && target.Type() != fastjson.TypeNull
+	}
+	if target == nil {
+		return f.op == "!="
+	}
+
+	c, comparable := 0, true
+	switch {
+	case target.Type() == fastjson.TypeString && f.value.Type() == fastjson.TypeString:
+		c = strings.Compare(string(target.GetStringBytes()), string(f.value.GetStringBytes()))
+	case target.Type() == fastjson.TypeNumber && f.value.Type() == fastjson.TypeNumber:
+		a, b := target.GetFloat64(), f.value.GetFloat64()
+		if a < b {
+			c = -1
+		} else if a > b {
+			c = 1
+		}
+	default:
+		// true, false and null are only equal to themselves
+		comparable = false
+		if target.Type() != f.value.Type() {
+			c = 1
+		}
+	}
+
+	switch f.op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	}
+
+	if !comparable {
+		return false
+	}
+
+	switch f.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+
+	return c >= 0
+}
+
+// selectAll returns every value of the document selected by the steps.
+func (k *responseKey) selectAll(doc *fastjson.Value) []*fastjson.Value {
+
+	values := []*fastjson.Value{doc}
+	for _, step := range k.steps {
+
+		next := []*fastjson.Value{}
+		for _, v := range values {
+
+			switch step.kind {
+
+			case stepName:
+				// Numbers select the elements of arrays, as fastjson does
+				if e := v.Get(step.name); e != nil {
+					next = append(next, e)
+				}
+
+			case stepIndex:
+				if a, err := v.Array(); err == nil {
+					i := step.index
+					if i < 0 {
+						i += len(a)
+					}
+					if i >= 0 && i < len(a) {
+						next = append(next, a[i])
+					}
+				}
+
+			case stepWildcard, stepFilter:
+				for _, e := range getChildren(v) {
+					if step.kind == stepWildcard || step.filter.match(e) {
+						next = append(next, e)
+					}
+				}
+
+			}
+
+		}
+		values = next
+
+	}
+
+	return values
+}
+
+// getChildren returns the elements of the array or the values of the object.
+func getChildren(v *fastjson.Value) []*fastjson.Value {
+
+	switch v.Type() {
+
+	case fastjson.TypeArray:
+		return v.GetArray()
+
+	case fastjson.TypeObject:
+		children := []*fastjson.Value{}
+		v.GetObject().Visit(func(_ []byte, e *fastjson.Value) {
+			children = append(children, e)
+		})
+		return children
+
+	}
+
+	return nil
+}
+
+// extractValue returns the value of the response selected by the key, nil when nothing is selected or the body is not JSON.
+// One of the selected values is picked by r, or the first one when r is nil. The error is of an invalid key.
+func extractValue(key string, header http.Header, body []byte, r *rand.Rand) (*fastjson.Value, error) {
+
+	k, err := compileKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if k.header != "" {
+
+		v := header.Get(k.header)
+		if v == "" {
+			return nil, nil
+		}
+
+		// The id of the created resource
+		if strings.EqualFold(k.header, "Location") {
+			if u, err := url.Parse(v); err == nil {
+				segments := strings.Split(strings.TrimRight(u.Path, "/"), "/")
+				v = segments[len(segments)-1]
+			}
+		}
+
+		return new(fastjson.Arena).NewString(v), nil
+	}
+
+	doc, err := fastjson.ParseBytes(body)
+	if err != nil {
+		return nil, nil
+	}
+
+	values := k.selectAll(doc)
+	switch {
+	case len(values) == 0:
+		return nil, nil
+	case r == nil || len(values) == 1:
+		return values[0], nil
+	}
+
+	return values[r.Intn(len(values))], nil
+}
+
+// getExtractedString returns the string of the value, numbers and the others are in JSON.
+func getExtractedString(v *fastjson.Value) string {
+
+	if v.Type() == fastjson.TypeString {
+		return string(v.GetStringBytes())
+	}
+
+	return string(v.MarshalTo(nil))
+}
+
+// getSchemaKeys returns the keys to look up the response schema, arrays are their element 0.
+// It returns false when the key selects a header, which is not in the schema.
+func getSchemaKeys(key string) ([]string, bool, error) {
+
+	k, err := compileKey(key)
+	if err != nil || k.header != "" {
+		return nil, false, err
+	}
+
+	keys := []string{}
+	for _, step := range k.steps {
+		if step.kind == stepName {
+			keys = append(keys, step.name)
+		} else {
+			keys = append(keys, "0")
+		}
+	}
+
+	return keys, true, nil
+}
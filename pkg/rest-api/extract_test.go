@@ -0,0 +1,167 @@
+package hsuanfuzz
+
+import (
+	"math/rand"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestExtractValue(t *testing.T) {
+
+	body := []byte(`{
+		"data": {"id": "d1", "a/b": "slash", "m~n": "tilde", "a%20b": "percent", "a b": "space"},
+		"items": [
+			{"id": 1, "status": "active", "price": 5, "name": "a==b", "ok": true},
+			{"id": 2, "status": "deleted", "price": 15, "name": "x]y", "ok": false},
+			{"id": 3, "status": "active", "price": 25, "name": "it's", "ok": null}
+		],
+		"": "empty key"
+	}`)
+	header := http.Header{"Location": {"http://api.local/items/42/?x=1"}, "Etag": {`"v1"`}}
+
+	tests := []struct {
+		name string
+		key  string
+		want string // empty when nothing is selected
+	}{
+		// JSON Pointer
+		{"pointer", "/data/id", "d1"},
+		{"pointer of an element", "/items/1/id", "2"},
+		{"pointer ~1", "/data/a~1b", "slash"},
+		{"pointer ~0", "/data/m~0n", "tilde"},
+		{"pointer is not percent-decoded", "/data/a%20b", "percent"},
+		{"pointer of the empty key", "/", "empty key"},
+		{"fragment", "#/data/id", "d1"},
+		{"fragment is percent-decoded", "#/data/a%20b", "space"},
+		{"fragment ~1 after decoding", "#/data/a%7E1b", "slash"},
+		{"runtime expression", "$response.body#/data/id", "d1"},
+		{"runtime expression is percent-decoded", "$response.body#/data/a%20b", "space"},
+		{"missing", "/data/nope", ""},
+
+		// JSONPath
+		{"name", "$.data.id", "d1"},
+		{"quoted name", "$['data']['a/b']", "slash"},
+		{"double quoted name", `$["data"]["a b"]`, "space"},
+		{"index", "$.items[0].id", "1"},
+		{"negative index", "$.items[-1].id", "3"},
+		{"negative index of the first", "$.items[-3].id", "1"},
+		{"negative index out of range", "$.items[-4].id", ""},
+		{"index out of range", "$.items[3].id", ""},
+		{"filter", "$.items[?(@.status=='deleted')].id", "2"},
+		{"filter with spaces", "$.items[?( @.status == 'deleted' )].id", "2"},
+		{"filter of a number", "$.items[?(@.price>20)].id", "3"},
+		{"filter of a number or equal", "$.items[?(@.price<=5)].id", "1"},
+		{"filter with an operator in quotes", "$.items[?(@.name=='a==b')].id", "1"},
+		{"filter with a bracket in quotes", "$.items[?(@.name=='x]y')].id", "2"},
+		{"filter with an escaped quote", `$.items[?(@.name=='it\'s')].id`, "3"},
+		{"filter with double quotes", `$.items[?(@.name=="it's")].id`, "3"},
+		{"filter of true", "$.items[?(@.ok==true)].id", "1"},
+		{"filter of null", "$.items[?(@.ok==null)].id", "3"},
+		{"filter of existence", "$.items[?(@.ok)].id", "1"},
+		{"filter of a missing key", "$.items[?(@.nope!='x')].id", "1"},
+		{"filter of no element", "$.items[?(@.status=='gone')].id", ""},
+		{"wildcard", "$.items[*].status", "active"},
+
+		// Headers
+		{"header", "$response.header.ETag", `"v1"`},
+		{"id of Location", "$response.header.Location", "42"},
+		{"missing header", "$response.header.X-Id", ""},
+
+		// The former syntax
+		{"former object", "data{id}", "d1"},
+		{"former array", "items[{id}]", "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			v, err := extractValue(tt.key, header, body, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := ""
+			if v != nil {
+				got = getExtractedString(v)
+			}
+			if got != tt.want {
+				t.Errorf("extractValue(%s) = %q, want %q", tt.key, got, tt.want)
+			}
+
+		})
+	}
+
+}
+
+func TestExtractValuePicked(t *testing.T) {
+
+	body := []byte(`{"items": [{"id": 1}, {"id": 2}, {"id": 3}]}`)
+	r := rand.New(rand.NewSource(1))
+
+	picked := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		v, err := extractValue("$.items[*].id", nil, body, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		picked[getExtractedString(v)] = true
+	}
+
+	if !reflect.DeepEqual(picked, map[string]bool{"1": true, "2": true, "3": true}) {
+		t.Errorf("picked %v of all the ids", picked)
+	}
+
+}
+
+func TestCompileKeyErrors(t *testing.T) {
+
+	keys := []string{
+		"$response.header.",
+		"$response.bodyx",
+		"#data",
+		"#/data/a%zzb",
+		"$..id",
+		"$.",
+		"$.items[0",
+		"$.items[x]",
+		"$.items[?(status=='a')]",
+		"$.items[?(@.status=='a)]",
+		"$.items[?(@.status==active)]",
+		"$['unclosed]",
+	}
+
+	for _, key := range keys {
+		if _, err := compileKey(key); err == nil {
+			t.Errorf("compileKey(%s) has no error", key)
+		}
+	}
+
+}
+
+func TestGetSchemaKeys(t *testing.T) {
+
+	tests := []struct {
+		key    string
+		want   []string
+		inBody bool
+	}{
+		{"/data/id", []string{"data", "id"}, true},
+		{"#/data/a%20b", []string{"data", "a b"}, true},
+		{"$.items[-1].id", []string{"items", "0", "id"}, true},
+		{"$.items[?(@.status=='active')].id", []string{"items", "0", "id"}, true},
+		{"items[{id}]", []string{"items", "0", "id"}, true},
+		{"$response.header.Location", nil, false},
+	}
+
+	for _, tt := range tests {
+		keys, inBody, err := getSchemaKeys(tt.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(keys, tt.want) || inBody != tt.inBody {
+			t.Errorf("getSchemaKeys(%s) = %q %v, want %q %v", tt.key, keys, inBody, tt.want, tt.inBody)
+		}
+	}
+
+}
@@ -27,6 +27,20 @@ func (x *HsuanFuzz) generateGrammar() {
 		}
 	}
 
+	// Sources of learned dependencies
+	for _, p := range x.sortedPaths {
+
+		visited := map[string]bool{}
+		for _, path := range orders[p] {
+			visited[path] = true
+		}
+
+		if flows := x.getLearnedFlows(p, visited); len(flows) > 0 {
+			orders[p] = append(flows, orders[p]...)
+		}
+
+	}
+
 	// Use path order to get operations
 	nodes := []*base.Node{}
 	group := uint32(1)
@@ -133,7 +147,15 @@ func (x *HsuanFuzz) getRequestParameters(ps map[string]*openapi3.ParameterRef, r
 
 	if rb != nil {
 
-		for mt, ref := range rb.Value.Content {
+		mediaTypes := []string{}
+		for mt := range rb.Value.Content {
+			mediaTypes = append(mediaTypes, mt)
+		}
+		sort.Strings(mediaTypes)
+
+		for _, mt := range mediaTypes {
+
+			ref := rb.Value.Content[mt]
 
 			if strings.Contains(strings.ToLower(mt), "json") {
 
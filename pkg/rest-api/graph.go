@@ -0,0 +1,319 @@
+package hsuanfuzz
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Formats of the dependency graph.
+const (
+	GraphDOT     = "dot"
+	GraphMermaid = "mermaid"
+)
+
+// Kinds of edges of the dependency graph.
+const (
+	edgeDependency = iota
+	edgeLearned
+	edgeFlow
+)
+
+// graphNode is an operation, or a path which is not in the specification.
+type graphNode struct {
+	id      string
+	label   string
+	level   int // -1 when unknown
+	missing bool
+}
+
+// graphEdge goes from the producer to the consumer, or from the POST to the operations of its flow.
+type graphEdge struct {
+	from  *graphNode
+	to    *graphNode
+	label string
+	kind  int
+}
+
+// uncovered reports whether the operation has never reached level 6 or 7.
+func (n *graphNode) uncovered() bool {
+	return n.level >= 0 && n.level < 6
+}
+
+// getGraph returns the operations and the edges of the dependencies and the flows of level 7.
+// The levels of cov are matched by their operations, the ones of other operations are ignored, cov is nil when unknown.
+func (x *HsuanFuzz) getGraph(dependency *Dependency, cov *Coverage) ([]*graphNode, []*graphEdge) {
+
+	levels := map[string]int{}
+	if cov != nil && len(cov.Operations) == len(cov.Levels) {
+		for i, label := range cov.Operations {
+			levels[label] = cov.Levels[i]
+		}
+	}
+
+	nodes := []*graphNode{}
+	operations := map[string]*graphNode{}
+	for _, path := range x.sortedPaths {
+		for _, method := range operationsOrder {
+
+			if x.openAPI.Paths[path].GetOperation(method) == nil {
+				continue
+			}
+
+			n := &graphNode{id: "op" + strconv.Itoa(len(nodes)+1), label: method + " " + path, level: -1}
+			if level, ok := levels[n.label]; ok {
+				n.level = level
+			}
+			nodes = append(nodes, n)
+			operations[n.label] = n
+
+		}
+	}
+
+	// Paths of Dependency.yml which are not in the specification
+	getPathNodes := func(path string) []*graphNode {
+
+		res := []*graphNode{}
+		for _, method := range operationsOrder {
+			if n, ok := operations[method+" "+path]; ok {
+				res = append(res, n)
+			}
+		}
+
+		if len(res) == 0 {
+			n, ok := operations[path]
+			if !ok {
+				n = &graphNode{id: "op" + strconv.Itoa(len(nodes)+1), label: path, level: -1, missing: true}
+				nodes = append(nodes, n)
+				operations[path] = n
+			}
+			res = append(res, n)
+		}
+
+		return res
+	}
+
+	edges := []*graphEdge{}
+	sections := []map[string]*DependencyInfo{dependency.Paths, dependency.Learned}
+	for i, section := range sections {
+
+		kind := edgeDependency
+		if i == 1 {
+			kind = edgeLearned
+		}
+
+		for _, path := range getSortedDependencyPaths(section) {
+
+			if section[path] == nil {
+				continue
+			}
+
+			for _, item := range section[path].Items {
+
+				if item.Source == nil || item.Source.Path == "" || item.Source.Path == "x" {
+					continue
+				}
+
+				label := item.Source.Key + " → " + item.Key
+				if kind == edgeLearned && item.Confidence > 0 {
+					label += fmt.Sprintf(" (%.2f)", item.Confidence)
+				}
+
+				for _, from := range getProducerNodes(item.Source.Path, getPathNodes) {
+					for _, to := range x.getConsumerNodes(path, item.Key, getPathNodes) {
+						edges = append(edges, &graphEdge{from: from, to: to, label: label, kind: kind})
+					}
+				}
+
+			}
+
+		}
+
+	}
+
+	for _, path := range getSortedPostPaths(dependency.Posts) {
+
+		post, ok := operations[http.MethodPost+" "+path]
+		if !ok || dependency.Posts[path] == nil {
+			continue
+		}
+
+		for _, flow := range dependency.Posts[path].Flows {
+
+			if flow.Path == "" {
+				continue
+			}
+
+			// The operation of the flow may be missing even if its path is not
+			label := flow.Method + " " + flow.Path
+			to, ok := operations[label]
+			if !ok {
+				to = &graphNode{id: "op" + strconv.Itoa(len(nodes)+1), label: label, level: -1, missing: true}
+				nodes = append(nodes, to)
+				operations[label] = to
+			}
+			edges = append(edges, &graphEdge{from: post, to: to, label: "level 7", kind: edgeFlow})
+
+		}
+
+	}
+
+	return nodes, edges
+}
+
+// getProducerNodes returns the POST and PUT operations of the source path, or all of them when it has neither.
+func getProducerNodes(path string, getPathNodes func(string) []*graphNode) []*graphNode {
+
+	all := getPathNodes(path)
+
+	producers := []*graphNode{}
+	for _, n := range all {
+		for _, method := range producerMethods {
+			if strings.HasPrefix(n.label, method+" ") {
+				producers = append(producers, n)
+			}
+		}
+	}
+
+	if len(producers) == 0 {
+		return all
+	}
+
+	return producers
+}
+
+// getConsumerNodes returns the operations of the path which have the key, or all of them when none has.
+func (x *HsuanFuzz) getConsumerNodes(path string, key string, getPathNodes func(string) []*graphNode) []*graphNode {
+
+	all := getPathNodes(path)
+	if x.openAPI.Paths[path] == nil {
+		return all
+	}
+
+	consumers := []*graphNode{}
+	for _, n := range all {
+		method := strings.SplitN(n.label, " ", 2)[0]
+		if x.getOperationKeys(path, method)[key] {
+			consumers = append(consumers, n)
+		}
+	}
+
+	if len(consumers) == 0 {
+		return all
+	}
+
+	return consumers
+}
+
+// WriteGraph renders the dependencies and the flows of level 7 as Graphviz DOT or Mermaid.
+// Operations which have never reached level 6 or 7 of the coverage are highlighted, cov may be nil.
+func (x *HsuanFuzz) WriteGraph(w io.Writer, format string, dependency *Dependency, cov *Coverage) error {
+
+	nodes, edges := x.getGraph(dependency, cov)
+
+	switch format {
+	case GraphDOT:
+		return writeDOT(w, x.openAPI.Info.Title, nodes, edges)
+	case GraphMermaid:
+		return writeMermaid(w, nodes, edges)
+	}
+
+	return errors.New("unknown format " + format)
+}
+
+func getNodeLabel(n *graphNode) string {
+
+	switch {
+	case n.missing:
+		return n.label + "\nnot in the specification"
+	case n.level >= 0:
+		return n.label + "\nlevel " + strconv.Itoa(n.level)
+	}
+
+	return n.label
+}
+
+func writeDOT(w io.Writer, title string, nodes []*graphNode, edges []*graphEdge) error {
+
+	quote := func(s string) string {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+		s = strings.ReplaceAll(s, `"`, `\"`)
+		return `"` + strings.ReplaceAll(s, "\n", `\n`) + `"`
+	}
+
+	lines := []string{
+		"digraph " + quote(title) + " {",
+		"  rankdir=LR;",
+		`  node [shape=box, fontname="Helvetica"];`,
+		`  edge [fontname="Helvetica", fontsize=10];`,
+	}
+
+	for _, n := range nodes {
+		attributes := "label=" + quote(getNodeLabel(n))
+		switch {
+		case n.missing:
+			attributes += `, style=dashed, color="#999999"`
+		case n.uncovered():
+			attributes += `, style=filled, fillcolor="#ffdddd", color="#cc0000"`
+		}
+		lines = append(lines, "  "+n.id+" ["+attributes+"];")
+	}
+
+	for _, e := range edges {
+		attributes := "label=" + quote(e.label)
+		switch e.kind {
+		case edgeLearned:
+			attributes += ", style=dashed"
+		case edgeFlow:
+			attributes += `, style=bold, color="#3366cc", fontcolor="#3366cc"`
+		}
+		lines = append(lines, "  "+e.from.id+" -> "+e.to.id+" ["+attributes+"];")
+	}
+
+	lines = append(lines, "}")
+
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+
+	return err
+}
+
+func writeMermaid(w io.Writer, nodes []*graphNode, edges []*graphEdge) error {
+
+	quote := func(s string) string {
+		s = strings.ReplaceAll(s, `"`, "#quot;")
+		return `"` + strings.ReplaceAll(s, "\n", "<br/>") + `"`
+	}
+
+	lines := []string{"flowchart LR"}
+
+	uncovered, missing := []string{}, []string{}
+	for _, n := range nodes {
+		lines = append(lines, "  "+n.id+"["+quote(getNodeLabel(n))+"]")
+		if n.missing {
+			missing = append(missing, n.id)
+		} else if n.uncovered() {
+			uncovered = append(uncovered, n.id)
+		}
+	}
+
+	arrows := map[int]string{edgeDependency: "-->", edgeLearned: "-.->", edgeFlow: "==>"}
+	for _, e := range edges {
+		lines = append(lines, "  "+e.from.id+" "+arrows[e.kind]+"|"+quote(e.label)+"| "+e.to.id)
+	}
+
+	if len(uncovered) > 0 {
+		lines = append(lines, "  classDef uncovered fill:#ffdddd,stroke:#cc0000")
+		lines = append(lines, "  class "+strings.Join(uncovered, ",")+" uncovered")
+	}
+	if len(missing) > 0 {
+		lines = append(lines, "  classDef missing stroke:#999999,stroke-dasharray:4")
+		lines = append(lines, "  class "+strings.Join(missing, ",")+" missing")
+	}
+
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+
+	return err
+}
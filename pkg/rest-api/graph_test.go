@@ -0,0 +1,133 @@
+package hsuanfuzz
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// newTestGraph returns the fuzzer of testDependencySpec and its dependencies, with a learned item, a flow and a path which is not in the specification.
+func newTestGraph(t *testing.T) (*HsuanFuzz, *Dependency) {
+
+	x := newTestFuzz(t, testDependencySpec)
+
+	dependency := &Dependency{
+		Paths: map[string]*DependencyInfo{
+			"/items":          {Items: []*DependencyItem{{Source: &DependencySource{Path: "x"}}}},
+			"/items/{itemId}": {Items: []*DependencyItem{{Key: "itemId", Source: &DependencySource{Path: "/items", Key: "/id"}}}},
+			"/gone/{goneId}":  {Items: []*DependencyItem{{Key: "goneId", Source: &DependencySource{Path: "/items", Key: "/id"}}}},
+		},
+		Posts: map[string]*DependencyPost{
+			"/items": {Flows: []*DependencyPostItem{{Method: "GET", Path: "/items/{itemId}"}, {Method: "DELETE", Path: "/items/{itemId}"}, {Method: "GET"}}},
+		},
+		Learned: map[string]*DependencyInfo{
+			"/owners/{ownerId}": {Items: []*DependencyItem{{Key: "ownerId", Source: &DependencySource{Path: "/items/{itemId}", Key: "/ownerId"}, Confidence: 0.8}}},
+		},
+	}
+
+	return x, dependency
+}
+
+func TestWriteGraph(t *testing.T) {
+
+	x, dependency := newTestGraph(t)
+
+	// The levels of GET /owners/{id} and DELETE /items/{itemId} are of operations which are not in the specification any more
+	cov := &Coverage{
+		Levels:     []int{7, 3, 5, 6},
+		Operations: []string{"POST /items", "GET /items/{itemId}", "GET /owners/{id}", "DELETE /items/{itemId}"},
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{
+			GraphDOT,
+			`digraph "Test" {
+  rankdir=LR;
+  node [shape=box, fontname="Helvetica"];
+  edge [fontname="Helvetica", fontsize=10];
+  op1 [label="POST /items\nlevel 7"];
+  op2 [label="GET /items/{itemId}\nlevel 3", style=filled, fillcolor="#ffdddd", color="#cc0000"];
+  op3 [label="GET /owners/{ownerId}"];
+  op4 [label="/gone/{goneId}\nnot in the specification", style=dashed, color="#999999"];
+  op5 [label="DELETE /items/{itemId}\nnot in the specification", style=dashed, color="#999999"];
+  op1 -> op4 [label="/id → goneId"];
+  op1 -> op2 [label="/id → itemId"];
+  op2 -> op3 [label="/ownerId → ownerId (0.80)", style=dashed];
+  op1 -> op2 [label="level 7", style=bold, color="#3366cc", fontcolor="#3366cc"];
+  op1 -> op5 [label="level 7", style=bold, color="#3366cc", fontcolor="#3366cc"];
+}
+`,
+		},
+		{
+			GraphMermaid,
+			`flowchart LR
+  op1["POST /items<br/>level 7"]
+  op2["GET /items/{itemId}<br/>level 3"]
+  op3["GET /owners/{ownerId}"]
+  op4["/gone/{goneId}<br/>not in the specification"]
+  op5["DELETE /items/{itemId}<br/>not in the specification"]
+  op1 -->|"/id → goneId"| op4
+  op1 -->|"/id → itemId"| op2
+  op2 -.->|"/ownerId → ownerId (0.80)"| op3
+  op1 ==>|"level 7"| op2
+  op1 ==>|"level 7"| op5
+  classDef uncovered fill:#ffdddd,stroke:#cc0000
+  class op2 uncovered
+  classDef missing stroke:#999999,stroke-dasharray:4
+  class op4,op5 missing
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+
+			b := &bytes.Buffer{}
+			if err := x.WriteGraph(b, tt.format, dependency, cov); err != nil {
+				t.Fatal(err)
+			}
+
+			if b.String() != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", b, tt.want)
+			}
+
+		})
+	}
+
+}
+
+func TestGetGraphLevels(t *testing.T) {
+
+	x, dependency := newTestGraph(t)
+
+	tests := []struct {
+		name string
+		cov  *Coverage
+		want []int
+	}{
+		{"unknown", nil, []int{-1, -1, -1}},
+		{"no operations of a former summary", &Coverage{Levels: []int{7, 6, 5}}, []int{-1, -1, -1}},
+		{"matched by the operations", &Coverage{Levels: []int{5, 7}, Operations: []string{"GET /owners/{ownerId}", "POST /items"}}, []int{7, -1, 5}},
+		{"operations of other levels", &Coverage{Levels: []int{7}, Operations: []string{"POST /items", "GET /items/{itemId}"}}, []int{-1, -1, -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			nodes, _ := x.getGraph(dependency, tt.cov)
+
+			got := []int{}
+			for _, n := range nodes[:3] {
+				got = append(got, n.level)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got the levels %v, want %v", got, tt.want)
+			}
+
+		})
+	}
+
+}
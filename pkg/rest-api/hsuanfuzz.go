@@ -1,15 +1,19 @@
 package hsuanfuzz
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math/rand"
 	"net/http"
 	"os"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
@@ -32,7 +36,6 @@ import (
 // TODO: mutate two location of each path (operations)
 // TODO: SET mutant and DEL some parameters
 // TODO: Change data type
-// TODO: Random 不夠隨機
 // TODO: 共二
 // TODO: string utf8 bytes ***
 // TODO: SEND JSON ONLY
@@ -59,6 +62,10 @@ type Dependency struct {
 	Count int                        `yaml:"count"`
 	Paths map[string]*DependencyInfo `yaml:"paths"`
 	Posts map[string]*DependencyPost `yaml:"posts"`
+
+	// Learned presents the dependencies learned from the responses, the items of Paths come first.
+	// They are saved to Learned.yml, see ReadDependency.
+	Learned map[string]*DependencyInfo `yaml:"learned,omitempty"`
 }
 
 // DependencyInfo presents the dependency of the path.
@@ -68,8 +75,9 @@ type DependencyInfo struct {
 
 // DependencyItem presents the ID and source required by the current path.
 type DependencyItem struct {
-	Key    string            `yaml:"key"`
-	Source *DependencySource `yaml:"source"`
+	Key        string            `yaml:"key"`
+	Source     *DependencySource `yaml:"source"`
+	Confidence float64           `yaml:"confidence,omitempty"` // score of the inference, see InferDependency
 }
 
 // DependencySource presents the source path and the ID field of the response.
@@ -96,7 +104,8 @@ type HsuanFuzz struct {
 	grammar     *base.Info
 	dependency  Dependency
 	Token       Token
-	groupInfo   *map[uint32]map[string]string
+	groupInfo   *map[uint32]map[string]*groupResponse
+	groupMu     sync.RWMutex
 	methods     int
 	sortedPaths []string
 	corpus      *gofuzz.PersistentSet
@@ -104,11 +113,30 @@ type HsuanFuzz struct {
 	endCov      Coverage
 	queue       []gofuzz.Sig
 	strictMode  bool
+	dirPath     string
+	Budget      Budget
+	Politeness  Politeness
+	Transport   Transport
+	Oracles     []Oracle
+	CookieJar   bool // keep the cookies of the responses for each principal
+	Learn       bool // learn dependencies by filling parameters with the values of the responses
+	client      *http.Client
+	clientOnce  sync.Once
+	clientErr   error
+	rand        *rand.Rand
+	mutator     *gofuzz.Mutator
+	mutated     map[*base.Node][]string
+	fills       map[*base.Node][]*fill
+	learning    learning
+	buckets     map[string]*Bucket
+	bucketMu    sync.Mutex
+	tokenMu     sync.RWMutex
 }
 
 // Coverage records the test coverage level of each path.
 type Coverage struct {
-	Levels []int
+	Levels     []int
+	Operations []string `yaml:"operations,omitempty"` // operation of each level, e.g. GET /items, only in the summary
 }
 
 func (c *Coverage) String() string {
@@ -119,18 +147,69 @@ func (c *Coverage) String() string {
 	return r
 }
 
-// Fuzz is equivalent to the execution of Fuzzer, continuously fuzzing.
-func (x *HsuanFuzz) Fuzz(guided bool) error {
+// Options presents the settings of a fuzzing campaign.
+type Options struct {
+	Guided   bool
+	Budget   Budget
+	Workers  int   // number of groups sent in parallel, Seed only reproduces the campaign with 1
+	Seed     int64 // seed of the campaign, 0 means a random seed
+	Minimize bool  // minimize the node of each new crasher
+}
+
+// Fuzz is equivalent to the execution of Fuzzer, continuously fuzzing until the budget is exhausted.
+func (x *HsuanFuzz) Fuzz(guided bool) (*Summary, error) {
+	return x.FuzzContext(context.Background(), Options{Guided: guided, Budget: x.Budget, Workers: 1})
+}
+
+// FuzzContext is the same as Fuzz, but stops gracefully when ctx is done.
+func (x *HsuanFuzz) FuzzContext(ctx context.Context, opts Options) (*Summary, error) {
 
 	log.Println("==================================================")
 	log.Println(fmt.Sprintf("%[1]*s", -50, fmt.Sprintf("%[1]*s", (50+len(x.openAPI.Info.Title))/2, x.openAPI.Info.Title)))
 	log.Println("==================================================")
 	log.Println(x.server)
 
+	if err := x.initClient(); err != nil {
+		return nil, err
+	}
+
+	// Same seed and same responses lead to the same requests
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	x.setSeed(seed)
+	log.Println("seed:", seed)
+
 	x.queue = []gofuzz.Sig{}
-	i := 0
+	c := newCampaign()
+
+	// Limits of the budget stop the requests in the middle of an iteration, as cancellation does
+	parent := ctx
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	c.stop = cancel
+	if opts.Budget.Duration > 0 {
+		ctx, c.stop = context.WithTimeout(ctx, opts.Budget.Duration)
+		defer c.stop()
+	}
+
+	stopped := func() string {
+		if parent.Err() == nil {
+			if reason := opts.Budget.exhausted(c); reason != "" {
+				return reason
+			}
+		}
+		return "canceled"
+	}
+
 	for {
 
+		// Stop between iterations
+		if ctx.Err() != nil {
+			return x.finish(c, stopped()), nil
+		}
+
 		// If there is no corpus, generate a grammar and add it
 		if len(x.corpus.M) == 0 {
 
@@ -146,11 +225,7 @@ func (x *HsuanFuzz) Fuzz(guided bool) error {
 			// 	panic(err)
 			// }
 
-			b, err := proto.Marshal(x.grammar)
-			if err != nil {
-				panic(err)
-			}
-			x.corpus.Add(gofuzz.Artifact{Data: b})
+			x.addCorpus(x.grammar)
 
 		}
 
@@ -161,6 +236,10 @@ func (x *HsuanFuzz) Fuzz(guided bool) error {
 				x.queue = append(x.queue, sig)
 			}
 
+			sort.Slice(x.queue, func(i, j int) bool {
+				return bytes.Compare(x.queue[i][:], x.queue[j][:]) < 0
+			})
+
 		}
 
 		// Dequeue
@@ -177,48 +256,24 @@ func (x *HsuanFuzz) Fuzz(guided bool) error {
 		// Modify
 		x.adoptStrategies()
 
-		// Get Token
-		if x.strictMode {
-			x.Token.Bearer = GetToken(x.Token, false)
+		// Get Token, only when it expires soon
+		if err := x.ensureTokens(ctx); err != nil {
+			fmt.Println()
+			if ctx.Err() != nil {
+				return x.finish(c, stopped()), nil
+			}
+			return x.finish(c, "token"), err
 		}
 
 		// Send requests and save responses
-		mapCodes := map[int]int{}
-		mapInfos := map[uint32][]*ResponseInfo{}
-
-		for _, node := range x.grammar.Nodes {
-
-			info := x.SendRequest(node, true)
-
-			mapInfos[node.Group] = append(mapInfos[node.Group], info)
-			mapCodes[info.Code]++
-
-			fmt.Printf("\r%d: %d %-7s %-100s", i+1, info.Code, info.request.Method, info.request.Path)
-
-			if info.Code >= 500 && info.Code != 599 {
-
-				// Set file name
-				name := info.request.Path
-				for _, r := range info.request.Requests {
-					name += r.Type
-				}
-
-				b, err := proto.Marshal(node)
-				if err != nil {
-					panic(err)
-				}
-
-				t := time.Now()
-				x.crashers.AddDescription([]byte(name), []byte(strconv.Itoa(info.Code)), "code")
-				x.crashers.AddDescription([]byte(name), []byte(t.Format("20060102 150405")), "timestamp")
-				x.crashers.AddDescription([]byte(name), b, "node")
-				x.crashers.AddDescription([]byte(name), []byte(info.request.String()), "request")
-				x.crashers.AddDescription([]byte(name), []byte(info.Body), "response")
-
-			}
+		mapInfos := x.sendGroups(ctx, c, opts)
 
+		if ctx.Err() != nil {
+			fmt.Println()
+			return x.finish(c, stopped()), nil
 		}
-		i++
+
+		c.iterations++
 		// Get test coverage levels
 		cov := x.getCoverageLevels(mapInfos)
 
@@ -228,15 +283,21 @@ func (x *HsuanFuzz) Fuzz(guided bool) error {
 
 			// Update coverage levels
 			x.endCov.Levels = newCov.Levels
+			c.plateau = 0
 
-			if guided {
+			if opts.Guided {
 				// Sava as new corpus
-				b, err := proto.Marshal(x.grammar)
-				if err != nil {
-					panic(err)
-				}
-				x.corpus.Add(gofuzz.Artifact{Data: b})
+				x.addCorpus(x.grammar)
 			}
+		} else {
+			c.plateau++
+		}
+
+		// Send the producers of the learned dependencies first from now on
+		if x.updateLearned() {
+			x.saveLearned()
+			x.generateGrammar()
+			x.addCorpus(x.grammar)
 		}
 
 		/* EVALUATION START */
@@ -257,9 +318,13 @@ func (x *HsuanFuzz) Fuzz(guided bool) error {
 		// }
 		/* EVALUATION END */
 
-	}
+		// Check the campaign budget
+		if reason := opts.Budget.exhausted(c); reason != "" {
+			fmt.Println()
+			return x.finish(c, reason), nil
+		}
 
-	return nil
+	}
 
 }
 
@@ -303,6 +368,10 @@ func New(openapiPath string, dirPath string, remove bool, strictMode bool) (*Hsu
 	path := dirPath + x.openAPI.Info.Title + "/"
 
 	if remove {
+		// Seeds written by hand would be lost, SeedsDir keeps them
+		if edited := getEditedSeeds(path + "corpus"); len(edited) > 0 {
+			return nil, &EditedSeedsError{Files: edited, SeedsDir: path + "seeds"}
+		}
 		os.RemoveAll(path + "corpus")
 		fmt.Printf("Corpus has been deleted \n")
 	}
@@ -320,7 +389,7 @@ func New(openapiPath string, dirPath string, remove bool, strictMode bool) (*Hsu
 		init := false
 		if _, err := os.Stat(tokenPath); os.IsNotExist(err) {
 			init = true
-			initializeTokenYAML(tokenPath)
+			x.initializeTokenYAML(tokenPath)
 		}
 		if _, err := os.Stat(dependencyPath); os.IsNotExist(err) {
 			init = true
@@ -347,85 +416,105 @@ func New(openapiPath string, dirPath string, remove bool, strictMode bool) (*Hsu
 		}
 
 		// Get dependencies
-		file, err = ioutil.ReadFile(dependencyPath)
+		dependency, problems, err := x.ReadDependency(dependencyPath)
 		if err != nil {
-			panic(err)
-		}
-
-		err = yaml.Unmarshal(file, &x.dependency)
-		if err != nil {
-			panic(err)
-		}
-
-		if len(x.openAPI.Paths) != len(x.dependency.Paths) {
-			panic("Invalid dependencies.")
+			return nil, err
 		}
+		x.dependency = *dependency
 
-		if x.Token.URL == "" && x.Token.Bearer == "" {
+		if x.Token.URL == "" && x.Token.Bearer == "" && !hasCredentials(&x.Token) {
 			panic("Token.yml is not ready yet.")
 		}
 
-		for _, p := range x.dependency.Paths {
-			for _, item := range p.Items {
-				if item.Source.Path == "" {
-					panic("Dependency.yml is not ready yet.")
-				}
-			}
+		// Incorrect dependencies lead to infinite loops or panics while fuzzing
+		if len(problems) > 0 {
+			return nil, &DependencyError{Problems: problems}
 		}
 
 	}
 
 	// Save responses with groups
-	r := make(map[uint32]map[string]string)
+	r := make(map[uint32]map[string]*groupResponse)
 
 	x.groupInfo = &r
+	x.dirPath = path
 	x.corpus = gofuzz.NewPersistentSet(path + "corpus")
 	x.crashers = gofuzz.NewPersistentSet(path + "crashers")
+	x.buckets = x.loadBuckets()
+	x.importReadable()
 	x.endCov = Coverage{Levels: make([]int, x.methods)}
 	x.strictMode = strictMode
+	x.Oracles = []Oracle{ServerErrorOracle{}}
+	x.setSeed(time.Now().UnixNano())
 
 	return x, nil
 }
 
-func initializeTokenYAML(p string) {
+// finish flushes the corpus and crashers, then writes the final coverage snapshot.
+func (x *HsuanFuzz) finish(c *campaign, reason string) *Summary {
+
+	summary := c.summary(x.endCov, reason)
+	summary.Coverage.Operations = x.getOperationLabels()
+	log.Println(summary)
 
-	encoded, err := yaml.Marshal(Token{})
+	x.corpus.Flush()
+	x.crashers.Flush()
+
+	encoded, err := yaml.Marshal(summary)
 	if err != nil {
 		panic(err)
 	}
 
-	err = ioutil.WriteFile(p, encoded, 0644)
+	err = ioutil.WriteFile(x.dirPath+"Coverage.yml", encoded, 0644)
 	if err != nil {
-		panic(err)
+		log.Println(err)
 	}
 
+	return summary
+
 }
 
-func (x *HsuanFuzz) initializeDependencyYAML(p string) {
+// ReadSummary reads the summary of the last campaign, which has the final coverage levels.
+func (x *HsuanFuzz) ReadSummary() (*Summary, error) {
 
-	dependency := Dependency{}
-	dependency.Count = len(x.sortedPaths)
-	dependency.Paths = map[string]*DependencyInfo{}
-	dependency.Posts = map[string]*DependencyPost{}
+	b, err := ioutil.ReadFile(x.dirPath + "Coverage.yml")
+	if err != nil {
+		return nil, err
+	}
 
-	for _, path := range x.sortedPaths {
-		items := []*DependencyItem{}
-		items = append(items, &DependencyItem{Source: &DependencySource{}})
+	summary := &Summary{}
+	if err := yaml.Unmarshal(b, summary); err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
 
-		dependency.Paths[path] = &DependencyInfo{}
-		dependency.Paths[path].Items = items
+func (x *HsuanFuzz) initializeTokenYAML(p string) {
 
-		if x.openAPI.Paths[path].GetOperation(http.MethodPost) != nil {
-			dependencyPost := DependencyPost{}
-			dependencyPost.Flows = append(dependencyPost.Flows, &DependencyPostItem{Method: http.MethodGet})
-			dependencyPost.Flows = append(dependencyPost.Flows, &DependencyPostItem{Method: http.MethodGet})
-			dependencyPost.Flows = append(dependencyPost.Flows, &DependencyPostItem{Method: http.MethodPatch})
-			dependencyPost.Flows = append(dependencyPost.Flows, &DependencyPostItem{Method: http.MethodDelete})
+	// Credentials of the security schemes to be entered
+	token := Token{Schemes: map[string]*Credential{}}
+	for name := range x.openAPI.Components.SecuritySchemes {
+		token.Schemes[name] = &Credential{}
+	}
 
-			dependency.Posts[path] = &dependencyPost
-		}
+	encoded, err := yaml.Marshal(token)
+	if err != nil {
+		panic(err)
 	}
 
+	err = ioutil.WriteFile(p, encoded, 0644)
+	if err != nil {
+		panic(err)
+	}
+
+}
+
+func (x *HsuanFuzz) initializeDependencyYAML(p string) {
+
+	// Proposed dependencies to be reviewed
+	dependency := x.InferDependency()
+
 	encoded, err := yaml.Marshal(dependency)
 	if err != nil {
 		panic(err)
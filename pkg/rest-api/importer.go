@@ -0,0 +1,473 @@
+package hsuanfuzz
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/iasthc/hsuan-fuzz/internal/base"
+	gofuzz "github.com/iasthc/hsuan-fuzz/internal/go-fuzz"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// RecordedRequest is a real request of a HAR file, Postman collection or access log.
+type RecordedRequest struct {
+	Method string
+	URL    *url.URL
+	Header http.Header
+	Body   []byte
+}
+
+// Import formats of recorded requests.
+const (
+	FormatHAR       = "har"
+	FormatPostman   = "postman"
+	FormatAccessLog = "log"
+)
+
+var (
+	reAccessLog = regexp.MustCompile(`"([A-Z]+) (\S+) HTTP/[0-9.]+"`)
+	reVariable  = regexp.MustCompile(`{{\s*([^{}]+?)\s*}}`)
+)
+
+// GetFormat guesses the format of the recorded requests from the file name.
+func GetFormat(file string) string {
+
+	name := strings.ToLower(filepath.Base(file))
+
+	switch {
+	case strings.HasSuffix(name, ".har"):
+		return FormatHAR
+	case strings.HasSuffix(name, ".json"):
+		return FormatPostman
+	}
+
+	return FormatAccessLog
+}
+
+// ParseRecorded reads the recorded requests of the format.
+func ParseRecorded(format string, b []byte) ([]*RecordedRequest, error) {
+
+	switch format {
+	case FormatHAR:
+		return ParseHAR(b)
+	case FormatPostman:
+		return ParsePostman(b)
+	case FormatAccessLog:
+		return ParseAccessLog(b)
+	}
+
+	return nil, errors.New("unknown format " + format)
+}
+
+// ParseHAR reads the requests of the entries of a HAR file, in the order they were sent.
+func ParseHAR(b []byte) ([]*RecordedRequest, error) {
+
+	har := struct {
+		Log struct {
+			Entries []struct {
+				Request struct {
+					Method  string `json:"method"`
+					URL     string `json:"url"`
+					Headers []struct {
+						Name  string `json:"name"`
+						Value string `json:"value"`
+					} `json:"headers"`
+					PostData *struct {
+						MimeType string `json:"mimeType"`
+						Text     string `json:"text"`
+					} `json:"postData"`
+				} `json:"request"`
+			} `json:"entries"`
+		} `json:"log"`
+	}{}
+
+	if err := json.Unmarshal(b, &har); err != nil {
+		return nil, err
+	}
+
+	requests := []*RecordedRequest{}
+	for _, entry := range har.Log.Entries {
+
+		u, err := url.Parse(entry.Request.URL)
+		if err != nil {
+			continue
+		}
+
+		r := &RecordedRequest{Method: strings.ToUpper(entry.Request.Method), URL: u, Header: http.Header{}}
+		for _, h := range entry.Request.Headers {
+			r.Header.Add(h.Name, h.Value)
+		}
+		if entry.Request.PostData != nil {
+			r.Body = []byte(entry.Request.PostData.Text)
+			if r.Header.Get("Content-Type") == "" {
+				r.Header.Set("Content-Type", entry.Request.PostData.MimeType)
+			}
+		}
+		requests = append(requests, r)
+
+	}
+
+	return requests, nil
+}
+
+// postmanItem is an item of a Postman collection (v2.1), either a folder or a request.
+type postmanItem struct {
+	Item    []*postmanItem `json:"item"`
+	Request *struct {
+		Method string `json:"method"`
+		Header []struct {
+			Key      string `json:"key"`
+			Value    string `json:"value"`
+			Disabled bool   `json:"disabled"`
+		} `json:"header"`
+		URL  json.RawMessage `json:"url"`
+		Body *struct {
+			Mode string `json:"mode"`
+			Raw  string `json:"raw"`
+		} `json:"body"`
+	} `json:"request"`
+}
+
+// ParsePostman reads the requests of a Postman collection (v2.1), the variables of the collection are substituted.
+func ParsePostman(b []byte) ([]*RecordedRequest, error) {
+
+	collection := struct {
+		postmanItem
+		Variable []struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		} `json:"variable"`
+	}{}
+
+	if err := json.Unmarshal(b, &collection); err != nil {
+		return nil, err
+	}
+
+	variables := map[string]string{}
+	for _, v := range collection.Variable {
+		variables[v.Key] = v.Value
+	}
+
+	substitute := func(s string) string {
+		return reVariable.ReplaceAllStringFunc(s, func(m string) string {
+			if v, ok := variables[reVariable.FindStringSubmatch(m)[1]]; ok {
+				return v
+			}
+			return m
+		})
+	}
+
+	requests := []*RecordedRequest{}
+
+	var walk func(items []*postmanItem)
+	walk = func(items []*postmanItem) {
+
+		for _, item := range items {
+
+			walk(item.Item)
+			if item.Request == nil {
+				continue
+			}
+
+			// The url is either a string or an object with the raw string
+			raw := ""
+			if err := json.Unmarshal(item.Request.URL, &raw); err != nil {
+				u := struct {
+					Raw string `json:"raw"`
+				}{}
+				if err := json.Unmarshal(item.Request.URL, &u); err != nil {
+					continue
+				}
+				raw = u.Raw
+			}
+
+			// Unknown variables of the base url are dropped, only the path is needed
+			raw = substitute(raw)
+			if loc := reVariable.FindStringIndex(raw); loc != nil && loc[0] == 0 {
+				raw = raw[loc[1]:]
+			}
+
+			u, err := url.Parse(raw)
+			if err != nil {
+				continue
+			}
+
+			method := strings.ToUpper(item.Request.Method)
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			r := &RecordedRequest{Method: method, URL: u, Header: http.Header{}}
+			for _, h := range item.Request.Header {
+				if !h.Disabled {
+					r.Header.Add(h.Key, substitute(h.Value))
+				}
+			}
+			if item.Request.Body != nil && item.Request.Body.Mode == "raw" {
+				r.Body = []byte(substitute(item.Request.Body.Raw))
+			}
+			requests = append(requests, r)
+
+		}
+
+	}
+	walk(collection.Item)
+
+	return requests, nil
+}
+
+// ParseAccessLog reads the request lines of an access log in the combined format of nginx, which has no headers and bodies.
+func ParseAccessLog(b []byte) ([]*RecordedRequest, error) {
+
+	requests := []*RecordedRequest{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+
+		m := reAccessLog.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+
+		u, err := url.ParseRequestURI(m[2])
+		if err != nil {
+			continue
+		}
+
+		requests = append(requests, &RecordedRequest{Method: m[1], URL: u, Header: http.Header{}})
+
+	}
+
+	return requests, scanner.Err()
+}
+
+// matchPath returns the path template of the specification matching the recorded path, and the values of its path parameters.
+// Templates with more fixed segments are preferred, e.g. /users/me over /users/{id}.
+func (x *HsuanFuzz) matchPath(method string, p string) (string, map[string]string) {
+
+	// Remove the base path of the server
+	if u, err := url.Parse(x.server); err == nil {
+		if base := strings.TrimRight(u.Path, "/"); base != "" && strings.HasPrefix(p, base) {
+			p = strings.TrimPrefix(p, base)
+		}
+	}
+
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+
+	best := ""
+	bestFixed := -1
+	var bestValues map[string]string
+	for _, path := range x.sortedPaths {
+
+		if x.openAPI.Paths[path].GetOperation(method) == nil {
+			continue
+		}
+
+		templates := strings.Split(strings.Trim(path, "/"), "/")
+		if len(templates) != len(segments) {
+			continue
+		}
+
+		fixed := 0
+		values := map[string]string{}
+		for i, t := range templates {
+
+			if strings.HasPrefix(t, "{") && strings.HasSuffix(t, "}") {
+				if segments[i] == "" {
+					fixed = -1
+					break
+				}
+				v, err := url.PathUnescape(segments[i])
+				if err != nil {
+					v = segments[i]
+				}
+				values[t[1:len(t)-1]] = v
+				continue
+			}
+
+			if t != segments[i] {
+				fixed = -1
+				break
+			}
+			fixed++
+
+		}
+
+		if fixed > bestFixed {
+			best, bestFixed, bestValues = path, fixed, values
+		}
+
+	}
+
+	return best, bestValues
+}
+
+// getParameterValue converts the recorded string to the type of the parameter schema, strings are base64 encoded.
+func getParameterValue(s string, ref *openapi3.ParameterRef) interface{} {
+
+	if ref.Value.Schema != nil && ref.Value.Schema.Value != nil {
+
+		switch ref.Value.Schema.Value.Type {
+		case "integer", "number":
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				return f
+			}
+		case "boolean":
+			if b, err := strconv.ParseBool(s); err == nil {
+				return b
+			}
+		}
+
+	}
+
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// newRecordedNode builds the node of a recorded request, the values which are not recorded are the examples of the specification.
+func (x *HsuanFuzz) newRecordedNode(group uint32, r *RecordedRequest) *base.Node {
+
+	path, pathValues := x.matchPath(r.Method, r.URL.Path)
+	if path == "" {
+		return nil
+	}
+
+	nodes := x.newNode(group, path, r.Method)
+	if len(nodes) == 0 {
+		return nil
+	}
+	node := proto.Clone(nodes[0]).(*base.Node)
+
+	operation := x.openAPI.Paths[path].GetOperation(r.Method)
+	parameterRefs := map[string]*openapi3.ParameterRef{}
+	for _, parameterRef := range append(x.openAPI.Paths[path].Parameters, operation.Parameters...) {
+		parameterRefs[parameterRef.Value.Name] = parameterRef
+	}
+
+	query := r.URL.Query()
+	for _, request := range node.Requests {
+
+		for _, name := range getSortedKeys(request.Value) {
+
+			ref, ok := parameterRefs[name]
+			if !ok || ref.Value.In != request.Type {
+				continue
+			}
+
+			s, found := "", false
+			switch request.Type {
+			case openapi3.ParameterInPath:
+				s, found = pathValues[name]
+			case openapi3.ParameterInQuery:
+				if _, found = query[name]; found {
+					s = query.Get(name)
+				}
+			case openapi3.ParameterInHeader:
+				if _, found = r.Header[http.CanonicalHeaderKey(name)]; found {
+					s = r.Header.Get(name)
+				}
+			}
+
+			if found {
+				v, err := structpb.NewValue(getParameterValue(s, ref))
+				if err != nil {
+					panic(err)
+				}
+				request.Value.Fields[name] = v
+			}
+
+		}
+
+		// JSON body
+		if strings.Contains(strings.ToLower(request.Type), "json") && len(r.Body) > 0 {
+
+			body := map[string]interface{}{}
+			if err := json.Unmarshal(r.Body, &body); err != nil {
+				continue
+			}
+
+			value, err := structpb.NewStruct(encodeValue(body).(map[string]interface{}))
+			if err != nil {
+				continue
+			}
+			request.Value = value
+
+		}
+
+	}
+
+	return node
+}
+
+// ImportRecorded adds the recorded requests to the corpus as one seed in their order, so the values produced by earlier requests can be used later.
+// The seed is written to SeedsDir as well, so it is kept when the corpus is deleted.
+// It returns the number of requests matching an operation of the specification.
+func (x *HsuanFuzz) ImportRecorded(requests []*RecordedRequest) (int, error) {
+
+	nodes := []*base.Node{}
+	for _, r := range requests {
+		if node := x.newRecordedNode(1, r); node != nil {
+			nodes = append(nodes, node)
+		}
+	}
+
+	if len(nodes) == 0 {
+		return 0, nil
+	}
+
+	info := &base.Info{Nodes: nodes}
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(info)
+	if err != nil {
+		return 0, err
+	}
+	r, err := MarshalReadable(info)
+	if err != nil {
+		return 0, err
+	}
+
+	sig := gofuzz.Hash(b)
+	if err := os.MkdirAll(x.SeedsDir(), 0770); err != nil {
+		return 0, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(x.SeedsDir(), hex.EncodeToString(sig[:])+".yml"), r, 0660); err != nil {
+		return 0, err
+	}
+
+	x.addCorpus(info)
+
+	return len(nodes), nil
+}
+
+// UnmatchedRecorded returns the operations of the recorded requests which are not in the specification.
+func (x *HsuanFuzz) UnmatchedRecorded(requests []*RecordedRequest) []string {
+
+	unmatched := map[string]bool{}
+	for _, r := range requests {
+		if path, _ := x.matchPath(r.Method, r.URL.Path); path == "" {
+			unmatched[r.Method+" "+r.URL.Path] = true
+		}
+	}
+
+	operations := []string{}
+	for operation := range unmatched {
+		operations = append(operations, operation)
+	}
+	sort.Strings(operations)
+
+	return operations
+}
@@ -0,0 +1,170 @@
+package hsuanfuzz
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// newTestFuzz returns the fuzzer of the specification in YAML, without a corpus.
+func newTestFuzz(t *testing.T, spec string) *HsuanFuzz {
+
+	openAPI, err := openapi3.NewSwaggerLoader().LoadSwaggerFromData([]byte(spec))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x := &HsuanFuzz{openAPI: openAPI, server: openAPI.Servers[0].URL}
+	for path := range openAPI.Paths {
+		x.sortedPaths = append(x.sortedPaths, path)
+	}
+	sort.Strings(x.sortedPaths)
+
+	return x
+}
+
+func TestParseHAR(t *testing.T) {
+
+	har := `{"log":{"entries":[
+		{"request":{"method":"post","url":"http://api.local/v1/items?x=1","headers":[{"name":"Authorization","value":"Bearer t"}],"postData":{"mimeType":"application/json","text":"{\"name\":\"a\"}"}}},
+		{"request":{"method":"GET","url":"http://api.local/v1/items/7","headers":[]}},
+		{"request":{"method":"GET","url":"://invalid","headers":[]}}
+	]}}`
+
+	requests, err := ParseHAR([]byte(har))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+
+	r := requests[0]
+	if r.Method != http.MethodPost || r.URL.Path != "/v1/items" || r.URL.Query().Get("x") != "1" {
+		t.Errorf("got %s %s", r.Method, r.URL)
+	}
+	if r.Header.Get("Authorization") != "Bearer t" || r.Header.Get("Content-Type") != "application/json" || string(r.Body) != `{"name":"a"}` {
+		t.Errorf("got header %v and body %q", r.Header, r.Body)
+	}
+	if requests[1].Body != nil {
+		t.Errorf("got body %q of a GET", requests[1].Body)
+	}
+
+	if _, err := ParseHAR([]byte("{")); err == nil {
+		t.Error("invalid HAR is parsed")
+	}
+
+}
+
+func TestParsePostman(t *testing.T) {
+
+	collection := `{
+		"variable":[{"key":"id","value":"7"},{"key":"token","value":"t"}],
+		"item":[
+			{"name":"folder","item":[
+				{"request":{"method":"post","url":"{{baseUrl}}/items","header":[{"key":"Authorization","value":"Bearer {{token}}"},{"key":"X-Off","value":"1","disabled":true}],"body":{"mode":"raw","raw":"{\"id\":\"{{id}}\"}"}}}
+			]},
+			{"request":{"url":{"raw":"{{baseUrl}}/items/{{id}}?q={{unknown}}"}}},
+			{"name":"no request"}
+		]
+	}`
+
+	requests, err := ParsePostman([]byte(collection))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		query  string
+		header http.Header
+		body   string
+	}{
+		{http.MethodPost, "/items", "", http.Header{"Authorization": {"Bearer t"}}, `{"id":"7"}`},
+		{http.MethodGet, "/items/7", "q={{unknown}}", http.Header{}, ""},
+	}
+
+	for i, tt := range tests {
+		r := requests[i]
+		if r.Method != tt.method || r.URL.Path != tt.path || r.URL.RawQuery != tt.query || !reflect.DeepEqual(r.Header, tt.header) || string(r.Body) != tt.body {
+			t.Errorf("request %d: got %s %s ? %s %v %q, want %s %s ? %s %v %q", i, r.Method, r.URL.Path, r.URL.RawQuery, r.Header, r.Body, tt.method, tt.path, tt.query, tt.header, tt.body)
+		}
+	}
+
+}
+
+func TestParseAccessLog(t *testing.T) {
+
+	log := `127.0.0.1 - - [18/Oct/2026:10:00:00 +0000] "GET /items/7?x=1 HTTP/1.1" 200 10 "-" "curl"
+not a request line
+127.0.0.1 - - [18/Oct/2026:10:00:01 +0000] "DELETE /items/%7E8 HTTP/2.0" 204 0 "-" "curl"
+127.0.0.1 - - [18/Oct/2026:10:00:02 +0000] "GET http//invalid HTTP/1.1" 400 0 "-" "curl"
+`
+
+	requests, err := ParseAccessLog([]byte(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, r := range requests {
+		got = append(got, r.Method+" "+r.URL.Path+" "+r.URL.RawQuery)
+	}
+	want := []string{"GET /items/7 x=1", "DELETE /items/~8 "}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+}
+
+func TestMatchPath(t *testing.T) {
+
+	x := newTestFuzz(t, `
+openapi: 3.0.0
+info: {title: Test, version: "1"}
+servers: [{url: "http://api.local/v1"}]
+paths:
+  /users/{id}:
+    get: {responses: {"200": {description: ok}}}
+  /users/me:
+    get: {responses: {"200": {description: ok}}}
+  /users/{id}/items/{itemId}:
+    delete: {responses: {"204": {description: ok}}}
+`)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   string
+		values map[string]string
+	}{
+		{"parameter", http.MethodGet, "/v1/users/7", "/users/{id}", map[string]string{"id": "7"}},
+		{"fixed segments first", http.MethodGet, "/v1/users/me", "/users/me", map[string]string{}},
+		{"unescaped values", http.MethodDelete, "/v1/users/a%20b/items/9", "/users/{id}/items/{itemId}", map[string]string{"id": "a b", "itemId": "9"}},
+		{"without the base path", http.MethodGet, "/users/7", "/users/{id}", map[string]string{"id": "7"}},
+		{"trailing slash", http.MethodGet, "/v1/users/7/", "/users/{id}", map[string]string{"id": "7"}},
+		{"empty parameter", http.MethodGet, "/v1/users/", "", nil},
+		{"other method", http.MethodPost, "/v1/users/7", "", nil},
+		{"other length", http.MethodGet, "/v1/users/7/items", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, values := x.matchPath(tt.method, tt.path)
+			if got != tt.want || !reflect.DeepEqual(values, tt.values) {
+				t.Errorf("matchPath(%s, %s) = %s %v, want %s %v", tt.method, tt.path, got, values, tt.want, tt.values)
+			}
+		})
+	}
+
+}
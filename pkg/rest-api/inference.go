@@ -0,0 +1,582 @@
+package hsuanfuzz
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// producerMethods are the operations whose responses provide the values of the consumers.
+var producerMethods = []string{http.MethodPost, http.MethodPut}
+
+// candidate is a possible source of a dependency key.
+type candidate struct {
+	path       string
+	keys       []string
+	confidence float64
+}
+
+// normalizeName makes parameter and property names comparable, e.g. orderId, order_id and Order-ID.
+func normalizeName(name string) string {
+
+	s := ""
+	for _, c := range strings.ToLower(name) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			s += string(c)
+		}
+	}
+
+	return s
+}
+
+// singularize returns the singular of a resource name, only the common English plurals.
+func singularize(name string) string {
+
+	switch {
+	case strings.HasSuffix(name, "ies") && len(name) > 3:
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "sses"), strings.HasSuffix(name, "xes"), strings.HasSuffix(name, "ches"), strings.HasSuffix(name, "shes"):
+		return strings.TrimSuffix(name, "es")
+	case strings.HasSuffix(name, "s") && !strings.HasSuffix(name, "ss"):
+		return strings.TrimSuffix(name, "s")
+	}
+
+	return name
+}
+
+// getResourceName returns the last fixed segment of the path, e.g. order of /users/{userId}/orders.
+func getResourceName(path string) string {
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		if !strings.HasPrefix(segments[i], "{") {
+			return singularize(normalizeName(segments[i]))
+		}
+	}
+
+	return ""
+}
+
+// isParentPath reports whether parent is a prefix of the segments of path, e.g. /users of /users/{userId}/orders.
+func isParentPath(parent string, path string) bool {
+
+	parent = strings.TrimRight(parent, "/")
+
+	return parent != "" && parent != path && strings.HasPrefix(path, parent+"/")
+}
+
+// formatKey converts the keys to a JSON Pointer, e.g. [data 0 id] to /data/0/id.
+func formatKey(keys []string) string {
+
+	s := ""
+	for _, k := range keys {
+		s += "/" + strings.ReplaceAll(strings.ReplaceAll(k, "~", "~0"), "/", "~1")
+	}
+
+	return s
+}
+
+// getResponseSchema returns the JSON schema of the first successful response of the operation.
+func getResponseSchema(operation *openapi3.Operation) *openapi3.Schema {
+
+	codes := []string{}
+	for code := range operation.Responses {
+		if strings.HasPrefix(code, "2") {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+
+		ref := operation.Responses[code]
+		if ref == nil || ref.Value == nil {
+			continue
+		}
+
+		for _, t := range getSortedContentTypes(ref.Value.Content) {
+			if strings.Contains(t, "json") && ref.Value.Content[t].Schema != nil && ref.Value.Content[t].Schema.Value != nil {
+				return ref.Value.Content[t].Schema.Value
+			}
+		}
+
+	}
+
+	return nil
+}
+
+func getSortedContentTypes(content openapi3.Content) []string {
+
+	types := []string{}
+	for t := range content {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+// getSchemaProperties returns the properties of the object schema including allOf, the item schema of an array is used.
+func getSchemaProperties(schema *openapi3.Schema) map[string]*openapi3.Schema {
+
+	properties := map[string]*openapi3.Schema{}
+	if schema == nil {
+		return properties
+	}
+
+	if schema.Type == "array" && schema.Items != nil {
+		return getSchemaProperties(schema.Items.Value)
+	}
+
+	for _, ref := range schema.AllOf {
+		if ref != nil {
+			for name, p := range getSchemaProperties(ref.Value) {
+				properties[name] = p
+			}
+		}
+	}
+
+	for name, ref := range schema.Properties {
+		if ref != nil && ref.Value != nil {
+			properties[name] = ref.Value
+		}
+	}
+
+	return properties
+}
+
+// getPropertyKeys returns the keys of the scalar properties of the response, the nested objects of the first level are included.
+func getPropertyKeys(schema *openapi3.Schema) [][]string {
+
+	keys := [][]string{}
+	if schema == nil {
+		return keys
+	}
+
+	// The first element
+	if schema.Type == "array" {
+		if schema.Items != nil && schema.Items.Value != nil && schema.Items.Value.Type != "array" {
+			for _, ks := range getPropertyKeys(schema.Items.Value) {
+				keys = append(keys, append([]string{"0"}, ks...))
+			}
+		}
+		return keys
+	}
+
+	properties := getSchemaProperties(schema)
+	names := []string{}
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+
+		p := properties[name]
+		if p.Type != "object" && p.Type != "array" {
+			keys = append(keys, []string{name})
+			continue
+		}
+
+		if p.Type == "object" {
+			for sub, q := range getSchemaProperties(p) {
+				if q.Type != "object" && q.Type != "array" {
+					keys = append(keys, []string{name, sub})
+				}
+			}
+		}
+
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return strings.Join(keys[i], ".") < strings.Join(keys[j], ".")
+	})
+
+	return keys
+}
+
+// getConsumerParameters returns the parameters which may need a produced value, all path parameters and the other parameters ending with id.
+func (x *HsuanFuzz) getConsumerParameters(path string) (names []string, required map[string]bool) {
+
+	found := map[string]bool{}
+	required = map[string]bool{}
+
+	add := func(name string, in string) {
+		if found[name] {
+			return
+		}
+		n := normalizeName(name)
+		if in == openapi3.ParameterInPath {
+			found[name], required[name] = true, true
+		} else if strings.HasSuffix(n, "id") && n != "id" {
+			found[name] = true
+		}
+	}
+
+	item := x.openAPI.Paths[path]
+	for _, method := range operationsOrder {
+
+		operation := item.GetOperation(method)
+		if operation == nil {
+			continue
+		}
+
+		for _, ref := range append(item.Parameters, operation.Parameters...) {
+			if ref != nil && ref.Value != nil {
+				add(ref.Value.Name, ref.Value.In)
+			}
+		}
+
+		if operation.RequestBody != nil && operation.RequestBody.Value != nil {
+			for _, t := range getSortedContentTypes(operation.RequestBody.Value.Content) {
+				if strings.Contains(t, "json") && operation.RequestBody.Value.Content[t].Schema != nil {
+					for name := range getSchemaProperties(operation.RequestBody.Value.Content[t].Schema.Value) {
+						add(name, "body")
+					}
+				}
+			}
+		}
+
+	}
+
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, required
+}
+
+// getLinkCandidates returns the sources of the parameters declared by the links of the responses, e.g.
+// links: {GetOrder: {operationId: getOrder, parameters: {orderId: $response.body#/id}}}
+func (x *HsuanFuzz) getLinkCandidates(operationPaths map[string]string) map[string]map[string][]*candidate {
+
+	// consumer path, parameter, sources
+	res := map[string]map[string][]*candidate{}
+
+	for _, path := range x.sortedPaths {
+
+		for _, method := range producerMethods {
+
+			operation := x.openAPI.Paths[path].GetOperation(method)
+			if operation == nil {
+				continue
+			}
+
+			codes := []string{}
+			for code := range operation.Responses {
+				codes = append(codes, code)
+			}
+			sort.Strings(codes)
+
+			for _, code := range codes {
+
+				ref := operation.Responses[code]
+				if ref == nil || ref.Value == nil {
+					continue
+				}
+
+				names := []string{}
+				for name := range ref.Value.Links {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+
+				for _, linkName := range names {
+
+					link := ref.Value.Links[linkName]
+					if link == nil || link.Value == nil {
+						continue
+					}
+
+					target := ""
+					if link.Value.OperationID != "" {
+						target = operationPaths[link.Value.OperationID]
+					} else if link.Value.OperationRef != "" {
+						target = getOperationRefPath(link.Value.OperationRef)
+					}
+					if target == "" || target == path || x.openAPI.Paths[target] == nil {
+						continue
+					}
+
+					for name, expression := range link.Value.Parameters {
+
+						s, ok := expression.(string)
+						if !ok || !strings.HasPrefix(s, "$response.body#") {
+							continue
+						}
+
+						keys := []string{}
+						for _, k := range strings.Split(strings.TrimPrefix(s, "$response.body#"), "/") {
+							if k != "" {
+								keys = append(keys, strings.ReplaceAll(strings.ReplaceAll(k, "~1", "/"), "~0", "~"))
+							}
+						}
+						if len(keys) == 0 {
+							continue
+						}
+
+						// The name may be qualified, e.g. path.orderId
+						if i := strings.Index(name, "."); i >= 0 {
+							name = name[i+1:]
+						}
+
+						if res[target] == nil {
+							res[target] = map[string][]*candidate{}
+						}
+						res[target][name] = append(res[target][name], &candidate{path: path, keys: keys, confidence: 1})
+
+					}
+
+				}
+
+			}
+
+		}
+
+	}
+
+	return res
+}
+
+// getOperationRefPath returns the path of a local operation reference, e.g. #/paths/~1orders~1{orderId}/get.
+func getOperationRefPath(ref string) string {
+
+	if !strings.HasPrefix(ref, "#/paths/") {
+		return ""
+	}
+
+	s := strings.TrimPrefix(ref, "#/paths/")
+	if i := strings.LastIndex(s, "/"); i >= 0 {
+		s = s[:i]
+	}
+
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~1", "/"), "~0", "~")
+}
+
+// scoreProperty returns how likely the property of the producer provides the parameter of the consumer, 0 for no match.
+// A producer which is not a parent of the consumer must be the resource named by the parameter, e.g. /orders for {orderId}.
+func scoreProperty(parameter string, consumer string, producer string, keys []string) float64 {
+
+	n := normalizeName(parameter)
+	property := normalizeName(keys[len(keys)-1])
+	resource := getResourceName(producer)
+	parent := isParentPath(producer, consumer)
+
+	if !parent && (resource == "" || (n != resource+"id" && n != resource)) {
+		return 0
+	}
+
+	score := 0.0
+	switch {
+	case property == n:
+		// orderId of the response for {orderId}
+		score = 0.9
+		if property == "id" {
+			score = 0.5
+		}
+	case property == "id" && resource != "" && resource+"id" == n:
+		// id of the response of /orders for {orderId}
+		score = 0.85
+	case property == "id" && strings.HasSuffix(n, "id") && parent && isNextParameter(producer, consumer, parameter):
+		// id of the response of /orders for /orders/{number}
+		score = 0.7
+	case property == "id" && parent && isNextParameter(producer, consumer, parameter):
+		score = 0.6
+	default:
+		return 0
+	}
+
+	if parent {
+		score += 0.05
+	}
+
+	// The id of a nested object is less likely to be the one, the elements of arrays are not nested
+	names := 0
+	for _, k := range keys {
+		if k != "0" {
+			names++
+		}
+	}
+	if names > 1 {
+		score -= 0.1
+	}
+
+	return score
+}
+
+// isNextParameter reports whether the parameter is the segment right after the producer path, e.g. {number} of /orders/{number}.
+func isNextParameter(producer string, consumer string, parameter string) bool {
+
+	rest := strings.TrimPrefix(consumer, strings.TrimRight(producer, "/")+"/")
+	segment := strings.SplitN(rest, "/", 2)[0]
+
+	return segment == "{"+parameter+"}"
+}
+
+// InferDependency proposes the dependencies of the paths from the specification.
+// Parameters are matched with the response properties of POST and PUT operations, and the links of the responses are used first.
+// The confidence of each item is between 0 and 1, items with no source have 0 and must be entered.
+func (x *HsuanFuzz) InferDependency() Dependency {
+
+	dependency := Dependency{}
+	dependency.Count = len(x.sortedPaths)
+	dependency.Paths = map[string]*DependencyInfo{}
+	dependency.Posts = map[string]*DependencyPost{}
+
+	operationPaths := map[string]string{}
+	producers := []string{}
+	schemas := map[string][][]string{}
+	for _, path := range x.sortedPaths {
+
+		for _, method := range operationsOrder {
+			if operation := x.openAPI.Paths[path].GetOperation(method); operation != nil && operation.OperationID != "" {
+				operationPaths[operation.OperationID] = path
+			}
+		}
+
+		for _, method := range producerMethods {
+			if operation := x.openAPI.Paths[path].GetOperation(method); operation != nil {
+				if keys := getPropertyKeys(getResponseSchema(operation)); len(keys) > 0 {
+					schemas[path] = append(schemas[path], keys...)
+				}
+			}
+		}
+		if len(schemas[path]) > 0 {
+			producers = append(producers, path)
+		}
+
+	}
+
+	links := x.getLinkCandidates(operationPaths)
+
+	// sources of the chosen items, to avoid cycles
+	edges := map[string]map[string]bool{}
+	reachable := func(from string, to string) bool {
+		visited := map[string]bool{}
+		var walk func(p string) bool
+		walk = func(p string) bool {
+			if p == to {
+				return true
+			}
+			if visited[p] {
+				return false
+			}
+			visited[p] = true
+			for q := range edges[p] {
+				if walk(q) {
+					return true
+				}
+			}
+			return false
+		}
+		return walk(from)
+	}
+
+	for _, path := range x.sortedPaths {
+
+		items := []*DependencyItem{}
+		names, required := x.getConsumerParameters(path)
+
+		for _, name := range names {
+
+			candidates := append([]*candidate{}, links[path][name]...)
+			for _, producer := range producers {
+
+				if producer == path {
+					continue
+				}
+
+				for _, keys := range schemas[producer] {
+					if score := scoreProperty(name, path, producer, keys); score > 0 {
+						candidates = append(candidates, &candidate{path: producer, keys: keys, confidence: score})
+					}
+				}
+
+			}
+
+			sort.SliceStable(candidates, func(i, j int) bool {
+				if candidates[i].confidence != candidates[j].confidence {
+					return candidates[i].confidence > candidates[j].confidence
+				}
+				// The closest parent
+				return len(candidates[i].path) > len(candidates[j].path)
+			})
+
+			var chosen *candidate
+			for _, c := range candidates {
+				if !reachable(c.path, path) {
+					chosen = c
+					break
+				}
+			}
+
+			if chosen == nil {
+				// Path parameters must be entered, the others are optional
+				if required[name] {
+					items = append(items, &DependencyItem{Key: name, Source: &DependencySource{}})
+				}
+				continue
+			}
+
+			if edges[path] == nil {
+				edges[path] = map[string]bool{}
+			}
+			edges[path][chosen.path] = true
+
+			items = append(items, &DependencyItem{
+				Key:        name,
+				Source:     &DependencySource{Path: chosen.path, Key: formatKey(chosen.keys)},
+				Confidence: math.Round(chosen.confidence*100) / 100,
+			})
+
+		}
+
+		// No dependency
+		if len(items) == 0 {
+			items = append(items, &DependencyItem{Source: &DependencySource{Path: "x"}, Confidence: 1})
+		}
+
+		dependency.Paths[path] = &DependencyInfo{Items: items}
+
+	}
+
+	// Flows of level 7, the operations of the consumers after the POST
+	for _, path := range x.sortedPaths {
+
+		if x.openAPI.Paths[path].GetOperation(http.MethodPost) == nil {
+			continue
+		}
+
+		dependencyPost := DependencyPost{}
+		for _, consumer := range x.sortedPaths {
+
+			if !edges[consumer][path] {
+				continue
+			}
+
+			for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+				if x.openAPI.Paths[consumer].GetOperation(method) != nil {
+					dependencyPost.Flows = append(dependencyPost.Flows, &DependencyPostItem{Method: method, Path: consumer})
+				}
+			}
+
+		}
+
+		// To be entered
+		if len(dependencyPost.Flows) == 0 {
+			dependencyPost.Flows = append(dependencyPost.Flows, &DependencyPostItem{Method: http.MethodGet})
+			dependencyPost.Flows = append(dependencyPost.Flows, &DependencyPostItem{Method: http.MethodGet})
+			dependencyPost.Flows = append(dependencyPost.Flows, &DependencyPostItem{Method: http.MethodPatch})
+			dependencyPost.Flows = append(dependencyPost.Flows, &DependencyPostItem{Method: http.MethodDelete})
+		}
+
+		dependency.Posts[path] = &dependencyPost
+
+	}
+
+	return dependency
+}
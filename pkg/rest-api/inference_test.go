@@ -0,0 +1,124 @@
+package hsuanfuzz
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestScoreProperty(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		parameter string
+		consumer  string
+		producer  string
+		keys      []string
+		want      float64
+	}{
+		{"named property of the parent", "orderId", "/orders/{orderId}", "/orders", []string{"orderId"}, 0.95},
+		{"id of the parent", "orderId", "/orders/{orderId}", "/orders", []string{"id"}, 0.9},
+		{"id for id of the parent", "id", "/users/{id}", "/users", []string{"id"}, 0.55},
+		{"id of the parent for the next parameter", "itemId", "/orders/{itemId}", "/orders", []string{"id"}, 0.75},
+		{"id of the parent for an unnamed parameter", "number", "/orders/{number}", "/orders", []string{"id"}, 0.65},
+		{"other property of the parent", "orderId", "/orders/{orderId}", "/orders", []string{"name"}, 0},
+		{"id of the named resource", "customerId", "/orders", "/customers", []string{"id"}, 0.85},
+		{"id of the elements of the named resource", "customerId", "/orders", "/customers", []string{"0", "id"}, 0.85},
+		{"nested id of the named resource", "customerId", "/orders", "/customers", []string{"data", "id"}, 0.75},
+		{"resource name as the parameter", "customer", "/orders", "/customers", []string{"customer"}, 0.9},
+		{"id of a sibling", "id", "/users/{id}", "/orders", []string{"id"}, 0},
+		{"named property of a sibling", "orderId", "/orders/{orderId}", "/payments", []string{"orderId"}, 0},
+		{"id of a sibling for the next parameter", "number", "/orders/{number}", "/payments", []string{"id"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scoreProperty(tt.parameter, tt.consumer, tt.producer, tt.keys); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("scoreProperty(%s, %s, %s, %v) = %v, want %v", tt.parameter, tt.consumer, tt.producer, tt.keys, got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestInferDependency(t *testing.T) {
+
+	x := newTestFuzz(t, `
+openapi: 3.0.0
+info: {title: Test, version: "1"}
+servers: [{url: "http://api.local"}]
+components:
+  schemas:
+    Created:
+      type: object
+      properties:
+        id: {type: string}
+        orderId: {type: string}
+paths:
+  /orders:
+    post:
+      responses:
+        "201": {description: ok, content: {application/json: {schema: {type: object, properties: {id: {type: string}}}}}}
+  /orders/{orderId}:
+    get:
+      parameters: [{name: orderId, in: path, required: true, schema: {type: string}}]
+      responses: {"200": {description: ok}}
+  /payments:
+    post:
+      requestBody: {content: {application/json: {schema: {type: object, properties: {orderId: {type: string}, amount: {type: number}}}}}}
+      responses:
+        "201": {description: ok, content: {application/json: {schema: {$ref: "#/components/schemas/Created"}}}}
+  /users/{id}:
+    get:
+      parameters: [{name: id, in: path, required: true, schema: {type: string}}]
+      responses: {"200": {description: ok}}
+`)
+
+	dependency := x.InferDependency()
+
+	tests := []struct {
+		path string
+		want []*DependencyItem
+	}{
+		// The parent, not the sibling /payments which returns orderId as well
+		{"/orders/{orderId}", []*DependencyItem{{Key: "orderId", Source: &DependencySource{Path: "/orders", Key: "/id"}, Confidence: 0.9}}},
+		{"/payments", []*DependencyItem{{Key: "orderId", Source: &DependencySource{Path: "/orders", Key: "/id"}, Confidence: 0.85}}},
+		// No parent nor resource named by id, to be entered
+		{"/users/{id}", []*DependencyItem{{Key: "id", Source: &DependencySource{}}}},
+		{"/orders", []*DependencyItem{{Source: &DependencySource{Path: "x"}, Confidence: 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := dependency.Paths[tt.path].Items; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %s, want %s", formatItems(got), formatItems(tt.want))
+			}
+		})
+	}
+
+	flows := dependency.Posts["/orders"].Flows
+	if len(flows) != 1 || flows[0].Method != "GET" || flows[0].Path != "/orders/{orderId}" {
+		t.Errorf("got the flows %s of /orders", formatFlows(flows))
+	}
+
+}
+
+func formatItems(items []*DependencyItem) string {
+
+	s := ""
+	for _, item := range items {
+		s += "[" + item.Key + " " + item.Source.Path + " " + item.Source.Key + "]"
+	}
+
+	return s
+}
+
+func formatFlows(flows []*DependencyPostItem) string {
+
+	s := ""
+	for _, flow := range flows {
+		s += "[" + flow.Method + " " + flow.Path + "]"
+	}
+
+	return s
+}
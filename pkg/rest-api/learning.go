@@ -0,0 +1,431 @@
+package hsuanfuzz
+
+import (
+	"io/ioutil"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/iasthc/hsuan-fuzz/internal/base"
+	"github.com/valyala/fastjson"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gopkg.in/yaml.v2"
+)
+
+// Learning keeps the values of the successful responses and the results of the requests filled with them.
+// The dependencies learned are written to Learned.yml in strict mode, see Dependency.Learned.
+type learning struct {
+	mu    sync.Mutex
+	pool  map[string]*poolEntry // by source
+	edges map[string]*edgeStat  // by consumer key and source
+	plain map[string]*edgeStat  // by consumer key, requests not filled from the pool
+}
+
+// poolEntry is the latest value of a key of the response of a producer path.
+type poolEntry struct {
+	source *DependencySource
+	keys   []string
+	value  *structpb.Value
+}
+
+// edgeStat counts the requests and their 2xx responses.
+type edgeStat struct {
+	path   string
+	key    string
+	source *DependencySource
+	sent   int
+	ok     int
+}
+
+// fill is a parameter of a node filled with a value of the pool.
+type fill struct {
+	key    string
+	source *DependencySource
+}
+
+// learnMinimum is the number of 2xx responses before a dependency is learned.
+const learnMinimum = 2
+
+// maxPoolDepth limits the keys of the values of the pool, e.g. data{user{id}} is 3.
+const maxPoolDepth = 3
+
+func (l *learning) init() {
+	if l.pool == nil {
+		l.pool = map[string]*poolEntry{}
+		l.edges = map[string]*edgeStat{}
+		l.plain = map[string]*edgeStat{}
+	}
+}
+
+// addPool saves the string and number values of the JSON response of the path to the pool.
+func (x *HsuanFuzz) addPool(path string, body string) {
+
+	if !x.Learn {
+		return
+	}
+
+	parsed, err := fastjson.Parse(body)
+	if err != nil {
+		return
+	}
+
+	x.learning.mu.Lock()
+	defer x.learning.mu.Unlock()
+	x.learning.init()
+
+	var walk func(v *fastjson.Value, keys []string)
+	walk = func(v *fastjson.Value, keys []string) {
+
+		switch v.Type() {
+
+		case fastjson.TypeObject:
+			if len(keys) >= maxPoolDepth {
+				return
+			}
+			v.GetObject().Visit(func(k []byte, e *fastjson.Value) {
+				walk(e, append(append([]string{}, keys...), string(k)))
+			})
+
+		case fastjson.TypeArray:
+			// Only the first element, the others are alike
+			if len(keys) < maxPoolDepth && len(v.GetArray()) > 0 {
+				walk(v.GetArray()[0], append(append([]string{}, keys...), "0"))
+			}
+
+		case fastjson.TypeString:
+			if len(keys) > 0 && len(v.GetStringBytes()) > 0 {
+				value, err := structpb.NewValue(v.GetStringBytes())
+				if err == nil {
+					x.learning.setPool(path, keys, value)
+				}
+			}
+
+		case fastjson.TypeNumber:
+			if len(keys) > 0 {
+				x.learning.setPool(path, keys, structpb.NewNumberValue(v.GetFloat64()))
+			}
+
+		}
+
+	}
+	walk(parsed, nil)
+
+}
+
+func (l *learning) setPool(path string, keys []string, value *structpb.Value) {
+
+	source := &DependencySource{Path: path, Key: formatKey(keys)}
+	l.pool[source.Path+" "+source.Key] = &poolEntry{source: source, keys: keys, value: value}
+
+}
+
+// isLearnable reports whether the parameter may be produced by another path, path parameters and the others ending with id.
+func isLearnable(t string, key string) bool {
+
+	n := normalizeName(key)
+
+	return t == "path" || (strings.HasSuffix(n, "id") && n != "id")
+}
+
+// fillFromPool sets the value of the parameter from the pool, the values of similar names are preferred.
+// It returns the source of the value, nil when the pool has no value of the type.
+func (x *HsuanFuzz) fillFromPool(node *base.Node, key string, value *structpb.Value) *DependencySource {
+
+	x.learning.mu.Lock()
+	defer x.learning.mu.Unlock()
+
+	sources := []string{}
+	for source, entry := range x.learning.pool {
+		if entry.source.Path != node.Path && isSameKind(entry.value, value) {
+			sources = append(sources, source)
+		}
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+	sort.Strings(sources)
+
+	best := []string{}
+	bestScore := 0.0
+	for _, source := range sources {
+		entry := x.learning.pool[source]
+		score := scoreProperty(key, node.Path, entry.source.Path, entry.keys)
+		if score > bestScore {
+			best, bestScore = []string{source}, score
+		} else if score == bestScore && score > 0 {
+			best = append(best, source)
+		}
+	}
+
+	// Unknown names are tried with any value, so unexpected dependencies are found
+	if len(best) == 0 {
+		best = sources
+	}
+
+	entry := x.learning.pool[best[x.rand.Intn(len(best))]]
+	if _, ok := entry.value.GetKind().(*structpb.Value_NumberValue); ok {
+		*value = *structpb.NewNumberValue(entry.value.GetNumberValue())
+	} else {
+		*value = *structpb.NewStringValue(entry.value.GetStringValue())
+	}
+
+	return entry.source
+}
+
+func isSameKind(a *structpb.Value, b *structpb.Value) bool {
+
+	switch a.GetKind().(type) {
+	case *structpb.Value_StringValue:
+		_, ok := b.GetKind().(*structpb.Value_StringValue)
+		return ok
+	case *structpb.Value_NumberValue:
+		_, ok := b.GetKind().(*structpb.Value_NumberValue)
+		return ok
+	}
+
+	return false
+}
+
+// learn counts the response of the node for the parameters filled from the pool and the others.
+func (x *HsuanFuzz) learn(node *base.Node, info *ResponseInfo) {
+
+	if !x.Learn {
+		return
+	}
+
+	filled := map[string]*DependencySource{}
+	for _, f := range x.fills[node] {
+		filled[f.key] = f.source
+	}
+
+	ok := info.Code/100 == 2
+
+	x.learning.mu.Lock()
+	defer x.learning.mu.Unlock()
+	x.learning.init()
+
+	for _, request := range node.Requests {
+		for _, k := range getSortedKeys(request.Value) {
+
+			ks, _ := getKeyValue(k, request.Value.GetFields()[k])
+			for _, key := range ks {
+
+				if !isLearnable(request.Type, key) {
+					continue
+				}
+
+				var stat *edgeStat
+				if source, found := filled[key]; found {
+					id := node.Path + " " + key + " " + source.Path + " " + source.Key
+					if x.learning.edges[id] == nil {
+						x.learning.edges[id] = &edgeStat{path: node.Path, key: key, source: source}
+					}
+					stat = x.learning.edges[id]
+				} else {
+					id := node.Path + " " + key
+					if x.learning.plain[id] == nil {
+						x.learning.plain[id] = &edgeStat{path: node.Path, key: key}
+					}
+					stat = x.learning.plain[id]
+				}
+
+				stat.sent++
+				if ok {
+					stat.ok++
+				}
+
+			}
+
+		}
+	}
+
+}
+
+// getRate returns the ratio of 2xx responses.
+func (s *edgeStat) getRate() float64 {
+
+	if s == nil || s.sent == 0 {
+		return 0
+	}
+
+	return float64(s.ok) / float64(s.sent)
+}
+
+// updateLearned adds the dependencies whose values get more 2xx responses than the others, to Dependency.Learned.
+// It reports whether a dependency is added or its source is changed.
+func (x *HsuanFuzz) updateLearned() bool {
+
+	if !x.Learn {
+		return false
+	}
+
+	x.learning.mu.Lock()
+	defer x.learning.mu.Unlock()
+
+	if x.dependency.Learned == nil {
+		x.dependency.Learned = map[string]*DependencyInfo{}
+	}
+
+	ids := []string{}
+	for id := range x.learning.edges {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	changed := false
+	for _, id := range ids {
+
+		stat := x.learning.edges[id]
+		rate := stat.getRate()
+		if stat.ok < learnMinimum || rate <= x.learning.plain[stat.path+" "+stat.key].getRate() {
+			continue
+		}
+
+		// Dependencies entered by hand are not changed
+		if x.hasManualItem(stat.path, stat.key) || x.isReachable(stat.source.Path, stat.path) {
+			continue
+		}
+
+		confidence := math.Round(rate*100) / 100
+		info := x.dependency.Learned[stat.path]
+		if info == nil {
+			info = &DependencyInfo{}
+			x.dependency.Learned[stat.path] = info
+		}
+
+		var item *DependencyItem
+		for _, i := range info.Items {
+			if i.Key == stat.key {
+				item = i
+			}
+		}
+
+		switch {
+		case item == nil:
+			info.Items = append(info.Items, &DependencyItem{Key: stat.key, Source: stat.source, Confidence: confidence})
+			changed = true
+		case *item.Source == *stat.source:
+			item.Confidence = confidence
+		case confidence > item.Confidence:
+			item.Source, item.Confidence = stat.source, confidence
+			changed = true
+		}
+
+	}
+
+	return changed
+}
+
+// hasManualItem reports whether Dependency.yml has the source of the key of the path in strict mode.
+func (x *HsuanFuzz) hasManualItem(path string, key string) bool {
+
+	if !x.strictMode || x.dependency.Paths[path] == nil {
+		return false
+	}
+
+	for _, item := range x.dependency.Paths[path].Items {
+		if item.Key == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getDependencyItems returns the items of Dependency.yml of the path and the learned items of the other keys.
+func (x *HsuanFuzz) getDependencyItems(path string) []*DependencyItem {
+
+	items := []*DependencyItem{}
+	if x.strictMode && x.dependency.Paths[path] != nil {
+		items = append(items, x.dependency.Paths[path].Items...)
+	}
+
+	if x.dependency.Learned[path] != nil {
+		for _, item := range x.dependency.Learned[path].Items {
+			if !x.hasManualItem(path, item.Key) {
+				items = append(items, item)
+			}
+		}
+	}
+
+	return items
+}
+
+// isReachable reports whether the path depends on the target, directly or not.
+func (x *HsuanFuzz) isReachable(path string, target string) bool {
+
+	visited := map[string]bool{}
+
+	var walk func(p string) bool
+	walk = func(p string) bool {
+		if p == target {
+			return true
+		}
+		if visited[p] {
+			return false
+		}
+		visited[p] = true
+		for _, item := range x.getDependencyItems(p) {
+			if item.Source != nil && item.Source.Path != "x" && item.Source.Path != "" && walk(item.Source.Path) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return walk(path)
+}
+
+// getLearnedFlows returns the source paths of the learned items of the path, the sources of the sources first.
+func (x *HsuanFuzz) getLearnedFlows(path string, visited map[string]bool) []string {
+
+	res := []string{}
+	if x.dependency.Learned[path] == nil {
+		return res
+	}
+
+	for _, item := range x.dependency.Learned[path].Items {
+
+		source := item.Source.Path
+		if visited[source] || x.openAPI.Paths[source] == nil || x.hasManualItem(path, item.Key) {
+			continue
+		}
+		visited[source] = true
+
+		res = append(res, x.getLearnedFlows(source, visited)...)
+		res = append(res, source)
+
+	}
+
+	return res
+}
+
+// saveLearned writes the learned dependencies to Learned.yml for review, only in strict mode.
+// Dependency.yml is edited by hand, so it is never rewritten.
+func (x *HsuanFuzz) saveLearned() {
+
+	if !x.strictMode {
+		return
+	}
+
+	encoded, err := yaml.Marshal(learnedDependency{Learned: x.dependency.Learned})
+	if err != nil {
+		panic(err)
+	}
+
+	err = ioutil.WriteFile(x.LearnedPath(), encoded, 0644)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	n := 0
+	for _, info := range x.dependency.Learned {
+		n += len(info.Items)
+	}
+	log.Println("learned dependencies: " + strconv.Itoa(n))
+
+}
@@ -0,0 +1,173 @@
+package hsuanfuzz
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Politeness limits the request rate and backs off when the target throttles us.
+type Politeness struct {
+	Rate       float64       // requests per second, 0 means unlimited
+	Burst      int           // maximum requests sent at once
+	MaxRetries int           // retries on 429 and 503
+	Backoff    time.Duration // first backoff when Retry-After is missing
+	MaxBackoff time.Duration
+}
+
+// isThrottled reports whether the response means the target refuses to serve us for now.
+func isThrottled(res *http.Response) bool {
+	return res.StatusCode == http.StatusTooManyRequests || (res.StatusCode == http.StatusServiceUnavailable && res.Header.Get("Retry-After") != "")
+}
+
+// tokenBucket is a token bucket rate limiter, it is safe for concurrent use.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// wait blocks until a token is available or ctx is done.
+func (b *tokenBucket) wait(ctx context.Context) error {
+
+	for {
+
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+
+		d := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		if err := sleep(ctx, d); err != nil {
+			return err
+		}
+
+	}
+
+}
+
+// politeTransport waits for the limiter before each request and retries throttled responses.
+type politeTransport struct {
+	base    http.RoundTripper
+	limiter *tokenBucket
+	p       Politeness
+}
+
+func newPoliteTransport(base http.RoundTripper, p Politeness) *politeTransport {
+	t := &politeTransport{base: base, p: p}
+	if p.Rate > 0 {
+		t.limiter = newTokenBucket(p.Rate, p.Burst)
+	}
+	if t.p.Backoff <= 0 {
+		t.p.Backoff = time.Second
+	}
+	if t.p.MaxBackoff <= 0 {
+		t.p.MaxBackoff = time.Minute
+	}
+	return t
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *politeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	backoff := t.p.Backoff
+	for retry := 0; ; retry++ {
+
+		if t.limiter != nil {
+			if err := t.limiter.wait(req.Context()); err != nil {
+				return nil, err
+			}
+		}
+
+		res, err := t.base.RoundTrip(req)
+		if err != nil || !isThrottled(res) || retry >= t.p.MaxRetries {
+			return res, err
+		}
+
+		// Rewind the body
+		if req.Body != nil && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return res, nil
+			}
+			req.Body = body
+		}
+
+		d := getRetryAfter(res.Header.Get("Retry-After"))
+		if d <= 0 {
+			d = backoff
+			backoff *= 2
+			if backoff > t.p.MaxBackoff {
+				backoff = t.p.MaxBackoff
+			}
+		}
+		if d > t.p.MaxBackoff {
+			d = t.p.MaxBackoff
+		}
+
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+
+		if err := sleep(req.Context(), d); err != nil {
+			return nil, err
+		}
+
+	}
+
+}
+
+// getRetryAfter parses the Retry-After header, which is either seconds or an HTTP date.
+func getRetryAfter(v string) time.Duration {
+
+	if v == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(v); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+
+	return 0
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+
+}
@@ -0,0 +1,139 @@
+package hsuanfuzz
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetRetryAfter(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"empty", "", 0, 0},
+		{"seconds", "3", 3 * time.Second, 3 * time.Second},
+		{"zero seconds", "0", 0, 0},
+		{"invalid", "soon", 0, 0},
+		{"future date", time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), 8 * time.Second, 10 * time.Second},
+		{"past date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), -2 * time.Hour, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if d := getRetryAfter(tt.value); d < tt.min || d > tt.max {
+				t.Errorf("getRetryAfter(%q) = %v, want between %v and %v", tt.value, d, tt.min, tt.max)
+			}
+		})
+	}
+
+}
+
+func TestIsThrottled(t *testing.T) {
+
+	tests := []struct {
+		code       int
+		retryAfter string
+		want       bool
+	}{
+		{http.StatusTooManyRequests, "", true},
+		{http.StatusServiceUnavailable, "1", true},
+		{http.StatusServiceUnavailable, "", false},
+		{http.StatusInternalServerError, "1", false},
+		{http.StatusOK, "", false},
+	}
+
+	for _, tt := range tests {
+		res := &http.Response{StatusCode: tt.code, Header: http.Header{}}
+		if tt.retryAfter != "" {
+			res.Header.Set("Retry-After", tt.retryAfter)
+		}
+		if got := isThrottled(res); got != tt.want {
+			t.Errorf("isThrottled(%d, %q) = %v, want %v", tt.code, tt.retryAfter, got, tt.want)
+		}
+	}
+
+}
+
+func TestTokenBucket(t *testing.T) {
+
+	b := newTokenBucket(20, 2)
+
+	// The burst is sent at once
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := b.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d > 20*time.Millisecond {
+		t.Errorf("burst waited %v", d)
+	}
+
+	// The next token comes after 1/rate
+	start = time.Now()
+	if err := b.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 30*time.Millisecond {
+		t.Errorf("waited %v, want about 50ms", d)
+	}
+
+	// Canceled while waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := b.wait(ctx); err != context.Canceled {
+		t.Errorf("wait of a canceled context = %v, want %v", err, context.Canceled)
+	}
+
+}
+
+func TestPoliteTransportRetry(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		throttled  int32
+		maxRetries int
+		wantCode   int
+		wantSent   int32
+	}{
+		{"retried until served", 2, 3, http.StatusOK, 3},
+		{"retries exhausted", 5, 1, http.StatusTooManyRequests, 2},
+		{"no retries", 1, 0, http.StatusTooManyRequests, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			var sent int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&sent, 1) <= tt.throttled {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			client := &http.Client{Transport: newPoliteTransport(http.DefaultTransport, Politeness{MaxRetries: tt.maxRetries, Backoff: time.Millisecond})}
+			res, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if res.StatusCode != tt.wantCode || sent != tt.wantSent {
+				t.Errorf("got %d after %d requests, want %d after %d", res.StatusCode, sent, tt.wantCode, tt.wantSent)
+			}
+
+		})
+	}
+
+}
@@ -0,0 +1,308 @@
+package hsuanfuzz
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/iasthc/hsuan-fuzz/internal/base"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// fieldPath locates a value in a request, string for struct fields and int for list indexes.
+type fieldPath []interface{}
+
+// walkFields calls fn on every value under v, parents before children.
+func walkFields(v *structpb.Value, p fieldPath, fn func(fieldPath, *structpb.Value)) {
+
+	switch v.GetKind().(type) {
+
+	case *structpb.Value_StructValue:
+
+		for _, k := range getSortedKeys(v.GetStructValue()) {
+			c := append(append(fieldPath{}, p...), k)
+			fn(c, v.GetStructValue().GetFields()[k])
+			walkFields(v.GetStructValue().GetFields()[k], c, fn)
+		}
+
+	case *structpb.Value_ListValue:
+
+		for i, e := range v.GetListValue().GetValues() {
+			c := append(append(fieldPath{}, p...), i)
+			fn(c, e)
+			walkFields(e, c, fn)
+		}
+
+	}
+
+}
+
+// getField returns the value of the path, or nil if it does not exist.
+func getField(v *structpb.Value, p fieldPath) *structpb.Value {
+
+	for _, e := range p {
+
+		switch e := e.(type) {
+
+		case string:
+			f, ok := v.GetStructValue().GetFields()[e]
+			if !ok {
+				return nil
+			}
+			v = f
+
+		case int:
+			vs := v.GetListValue().GetValues()
+			if e >= len(vs) {
+				return nil
+			}
+			v = vs[e]
+
+		}
+
+	}
+
+	return v
+}
+
+// deleteField removes the value of the path, and reports whether it existed.
+func deleteField(v *structpb.Value, p fieldPath) bool {
+
+	if len(p) == 0 {
+		return false
+	}
+
+	parent := getField(v, p[:len(p)-1])
+	if parent == nil {
+		return false
+	}
+
+	switch e := p[len(p)-1].(type) {
+
+	case string:
+		if _, ok := parent.GetStructValue().GetFields()[e]; ok {
+			delete(parent.GetStructValue().GetFields(), e)
+			return true
+		}
+
+	case int:
+		if l := parent.GetListValue(); l != nil && e < len(l.Values) {
+			l.Values = append(l.Values[:e], l.Values[e+1:]...)
+			return true
+		}
+
+	}
+
+	return false
+}
+
+// reproduces replays the node and reports whether one of its findings falls in the bucket b, the same bug.
+// The responses are not saved as the sources of dependencies, and the requests are counted by the campaign c when it is not nil.
+func (x *HsuanFuzz) reproduces(ctx context.Context, node *base.Node, b *Bucket, c *campaign, limit int) bool {
+
+	if c != nil && !c.reserve(limit) {
+		return false
+	}
+
+	info, probes := x.sendProbed(ctx, node, false)
+	if c != nil {
+		c.addProbes(len(probes) - 1)
+	}
+	if ctx.Err() != nil || info.Throttled || info.Timeout {
+		return false
+	}
+
+	// The signature has the parameters mutated by the fuzzer, not the ones left by the minimizer
+	mutated := strings.Split(b.Parameter, ",")
+	for _, p := range probes {
+		for _, f := range p.Findings {
+			if x.newBucket(node, p.Info, f, mutated).Signature == b.Signature {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// getOriginal returns the requests of the node generated from the examples of the specification.
+func (x *HsuanFuzz) getOriginal(node *base.Node) map[string]*structpb.Value {
+
+	original := map[string]*structpb.Value{}
+
+	nodes := x.newNode(node.Group, node.Path, node.Method)
+	if len(nodes) == 0 {
+		return original
+	}
+
+	for _, request := range nodes[0].Requests {
+		original[getRequestID(request)] = structpb.NewStructValue(request.Value)
+	}
+
+	return original
+}
+
+// getRequestID identifies a request of a node, the name of a parameter or the media type of a body.
+func getRequestID(request *base.Request) string {
+
+	if strings.Contains(strings.ToLower(request.Type), "json") {
+		return request.Type
+	}
+
+	return request.Type + ":" + strings.Join(getSortedKeys(request.Value), ",")
+}
+
+// Minimize replays the node and shrinks it while it still falls in the bucket b, see Buckets.
+// It drops parameters and body fields, restores the examples of the specification and shortens strings toward them.
+func (x *HsuanFuzz) Minimize(ctx context.Context, node *base.Node, b *Bucket) *base.Node {
+	return x.minimize(ctx, node, b, nil, 0)
+}
+
+// minimize is the same as Minimize, the replays are counted by the campaign c and stop at the limit of requests.
+func (x *HsuanFuzz) minimize(ctx context.Context, node *base.Node, b *Bucket, c *campaign, limit int) *base.Node {
+
+	best := proto.Clone(node).(*base.Node)
+
+	try := func(candidate *base.Node) bool {
+		if x.reproduces(ctx, candidate, b, c, limit) {
+			best = candidate
+			return true
+		}
+		return false
+	}
+
+	// Make sure the finding is reproducible at all
+	if !x.reproduces(ctx, best, b, c, limit) {
+		return best
+	}
+
+	// Drop parameters, path parameters are needed to build the URL
+	for i := 0; i < len(best.Requests) && ctx.Err() == nil; {
+
+		if best.Requests[i].Type == openapi3.ParameterInPath {
+			i++
+			continue
+		}
+
+		c := proto.Clone(best).(*base.Node)
+		c.Requests = append(c.Requests[:i], c.Requests[i+1:]...)
+		if !try(c) {
+			i++
+		}
+
+	}
+
+	// Drop body fields, parents first, and start again after each success since list indexes shift
+	for i := range best.Requests {
+
+		if !strings.Contains(strings.ToLower(best.Requests[i].Type), "json") {
+			continue
+		}
+
+		for changed := true; changed && ctx.Err() == nil; {
+
+			changed = false
+
+			paths := []fieldPath{}
+			walkFields(structpb.NewStructValue(best.Requests[i].Value), fieldPath{}, func(p fieldPath, v *structpb.Value) {
+				paths = append(paths, p)
+			})
+
+			for _, p := range paths {
+				c := proto.Clone(best).(*base.Node)
+				if deleteField(structpb.NewStructValue(c.Requests[i].Value), p) && try(c) {
+					changed = true
+					break
+				}
+			}
+
+		}
+
+	}
+
+	// Restore mutated values, then shorten the strings which are still needed
+	original := x.getOriginal(best)
+	for i := range best.Requests {
+
+		o, ok := original[getRequestID(best.Requests[i])]
+		if !ok {
+			continue
+		}
+
+		paths := []fieldPath{}
+		walkFields(structpb.NewStructValue(best.Requests[i].Value), fieldPath{}, func(p fieldPath, v *structpb.Value) {
+			switch v.GetKind().(type) {
+			case *structpb.Value_StructValue, *structpb.Value_ListValue:
+			default:
+				paths = append(paths, p)
+			}
+		})
+
+		for _, p := range paths {
+
+			if ctx.Err() != nil {
+				return best
+			}
+
+			want := getField(o, p)
+			if want == nil || proto.Equal(want, getField(structpb.NewStructValue(best.Requests[i].Value), p)) {
+				continue
+			}
+
+			c := proto.Clone(best).(*base.Node)
+			getField(structpb.NewStructValue(c.Requests[i].Value), p).Kind = proto.Clone(want).(*structpb.Value).Kind
+			if try(c) {
+				continue
+			}
+
+			// Halve the part of the string beyond the length of the example
+			v := getField(structpb.NewStructValue(best.Requests[i].Value), p)
+			if v.GetStringValue() == "" || want.GetStringValue() == "" {
+				continue
+			}
+
+			s := x.getStringValue(v, true, false)
+			o := x.getStringValue(want, true, false)
+			for len(s) > len(o) && ctx.Err() == nil {
+
+				n := len(s) - (len(s)-len(o)+1)/2
+
+				c := proto.Clone(best).(*base.Node)
+				getField(structpb.NewStructValue(c.Requests[i].Value), p).Kind = structpb.NewStringValue(base64.StdEncoding.EncodeToString([]byte(s[:n]))).Kind
+				if !try(c) {
+					break
+				}
+				s = s[:n]
+
+			}
+
+		}
+
+	}
+
+	return best
+}
+
+// saveMinimized writes the minimal node of the crasher next to the original one, the replays are limited by the budget of requests.
+func (x *HsuanFuzz) saveMinimized(ctx context.Context, c *campaign, limit int, name string, node *base.Node) {
+
+	x.bucketMu.Lock()
+	b := *x.buckets[name]
+	x.bucketMu.Unlock()
+
+	minimized := x.minimize(ctx, node, &b, c, limit)
+	if ctx.Err() != nil {
+		return
+	}
+
+	encoded, err := proto.Marshal(minimized)
+	if err != nil {
+		panic(err)
+	}
+
+	x.crashers.AddDescription([]byte(name), encoded, "minimized")
+	x.crashers.AddDescription([]byte(name), []byte(minimized.String()), "minimized.request")
+
+}
@@ -0,0 +1,83 @@
+package hsuanfuzz
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/iasthc/hsuan-fuzz/internal/base"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestMinimize(t *testing.T) {
+
+	// The server fails on a single field, a name with an exclamation mark
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if name, _ := body["name"].(string); strings.Contains(name, "!") {
+			http.Error(w, "invalid character in name", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"1"}`))
+	}))
+	defer server.Close()
+
+	x := newTestCampaign(t, server.URL, `
+paths:
+  /items:
+    post:
+      parameters: [{name: trace, in: query, schema: {type: string}}]
+      requestBody: {content: {application/json: {schema: {type: object, properties: {name: {type: string, example: app}, count: {type: integer}, tags: {type: array, items: {type: string}}}}}}}
+      responses: {"201": {description: ok}}
+`)
+	x.Oracles = []Oracle{ServerErrorOracle{}}
+
+	node := newTestNode(t, "/items", http.MethodPost, "application/json", map[string]interface{}{
+		"name":  "ap!" + strings.Repeat("x", 40),
+		"count": 3.0,
+		"tags":  []interface{}{"a", "b"},
+		"meta":  map[string]interface{}{"owner": "me"},
+	})
+	query, err := structpb.NewStruct(encodeValue(map[string]interface{}{"trace": "on"}).(map[string]interface{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.Requests = append(node.Requests, &base.Request{Type: "query", Value: query})
+	original := proto.Clone(node)
+
+	info, probes := x.sendProbed(context.Background(), node, false)
+	findings := probes[len(probes)-1].Findings
+	if len(findings) != 1 {
+		t.Fatalf("got the findings %v of %d %s, want one", findings, info.Code, info.Body)
+	}
+	b := x.newBucket(node, info, findings[0], []string{"name"})
+
+	minimized := x.Minimize(context.Background(), node, b)
+
+	if !proto.Equal(node, original) {
+		t.Error("the node was changed")
+	}
+	if !x.reproduces(context.Background(), minimized, b, nil, 0) {
+		t.Error("the minimized node does not fall in the bucket")
+	}
+
+	// Only the body with the name is left, and the name is shortened toward the example
+	if len(minimized.Requests) != 1 {
+		t.Fatalf("got %d requests, want the body only", len(minimized.Requests))
+	}
+	fields := minimized.Requests[0].Value.GetFields()
+	if len(fields) != 1 || fields["name"] == nil {
+		t.Fatalf("got the fields %v, want the name only", fields)
+	}
+	if name := x.getStringValue(fields["name"], true, false); name != "ap!" {
+		t.Errorf("got the name %q, want %q", name, "ap!")
+	}
+
+}
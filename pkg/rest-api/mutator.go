@@ -3,9 +3,10 @@ package hsuanfuzz
 import (
 	"encoding/base64"
 	"math/rand"
+	"sort"
 	"strconv"
-	"time"
 
+	"github.com/iasthc/hsuan-fuzz/internal/base"
 	gofuzz "github.com/iasthc/hsuan-fuzz/internal/go-fuzz"
 	"github.com/valyala/fastjson"
 	"google.golang.org/protobuf/encoding/protojson"
@@ -109,8 +110,9 @@ func getKeyValue(k string, x *structpb.Value) ([]string, []*structpb.Value) {
 
 	case *structpb.Value_StructValue:
 
-		for a, b := range x.GetStructValue().GetFields() {
+		for _, a := range getSortedKeys(x.GetStructValue()) {
 
+			b := x.GetStructValue().GetFields()[a]
 			_ks, _vs := getKeyValue(a, b)
 			ks = append(ks, _ks...)
 			vs = append(vs, _vs...)
@@ -130,8 +132,9 @@ func getKeyValue(k string, x *structpb.Value) ([]string, []*structpb.Value) {
 
 			case *structpb.Value_StructValue:
 
-				for a, b := range c.GetStructValue().GetFields() {
+				for _, a := range getSortedKeys(c.GetStructValue()) {
 
+					b := c.GetStructValue().GetFields()[a]
 					_ks, _vs := getKeyValue(a, b)
 					ks = append(ks, _ks...)
 					vs = append(vs, _vs...)
@@ -151,8 +154,9 @@ func getKeyValue(k string, x *structpb.Value) ([]string, []*structpb.Value) {
 
 					case *structpb.Value_StructValue:
 
-						for a, b := range d.GetStructValue().GetFields() {
+						for _, a := range getSortedKeys(d.GetStructValue()) {
 
+							b := d.GetStructValue().GetFields()[a]
 							_ks, _vs := getKeyValue(a, b)
 							ks = append(ks, _ks...)
 							vs = append(vs, _vs...)
@@ -176,136 +180,197 @@ func getKeyValue(k string, x *structpb.Value) ([]string, []*structpb.Value) {
 	return ks, vs
 }
 
-func (x *HsuanFuzz) isRelated(path string, key string) bool {
+// getSortedKeys returns the field names of s in order, so the same seed selects the same parameters.
+func getSortedKeys(s *structpb.Struct) []string {
 
-	if x.strictMode {
+	keys := []string{}
+	for k := range s.GetFields() {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
 
-		for _, item := range x.dependency.Paths[path].Items {
-			if item.Key == key {
-				return true
-			}
-		}
+	return keys
+}
+
+// setSeed makes the strategy choice, parameter selection and mutation reproducible.
+func (x *HsuanFuzz) setSeed(seed int64) {
+	x.rand = rand.New(rand.NewSource(seed))
+	x.mutator = gofuzz.NewSeededMutator(uint64(x.rand.Int63()))
+}
+
+func (x *HsuanFuzz) isRelated(path string, key string) bool {
 
+	for _, item := range x.getDependencyItems(path) {
+		if item.Key == key {
+			return true
+		}
 	}
 
 	return false
 }
 
-func (x *HsuanFuzz) adoptStrategies() {
+// parseKey converts the former syntax of keys to fastjson keys, e.g. data[{id}] to [data 0 id], see compileKey.
+func parseKey(s string) []string {
 
-	for _, node := range x.grammar.Nodes {
+	keys := []string{}
+	key := ""
+	for _, c := range s {
 
-		values := []*structpb.Value{}
-		keys := []string{}
+		if c == '{' {
 
-		// Get all request values
-		for _, request := range node.Requests {
+			keys = append(keys, key)
+			key = ""
 
-			for k, v := range request.Value.GetFields() {
+		} else if c == '[' {
 
-				ks, vs := getKeyValue(k, v)
-				keys = append(keys, ks...)
-				values = append(values, vs...)
+			keys = append(keys, key)
+			key = ""
+			key += "0"
+
+		} else if c == ']' || c == '}' {
 
+			if len(key) > 0 {
+				keys = append(keys, key)
+				key = ""
 			}
 
+		} else {
+
+			key += string(c)
+
 		}
 
-		// Choose two parameters to modify
-		selected := map[int]bool{}
+	}
 
-		if len(values) >= 2 {
+	// e.g. id
+	if len(key) > 0 {
+		keys = append(keys, key)
+	}
 
-			record := -1
+	return keys
+}
 
-			for len(selected) < 2 {
+// setDependency sets the value of the key from the response of its source path in the same group.
+func (x *HsuanFuzz) setDependency(node *base.Node, key string, value *structpb.Value) {
 
-				rand.Seed(time.Now().UnixNano())
-				random := rand.Intn(len(values))
+	if x.isRelated(node.Path, key) {
 
-				if record == random {
+		for _, item := range x.getDependencyItems(node.Path) {
+
+			// A path may depend on several sources
+			if item.Key != key {
+				continue
+			}
+
+			// Get id from the previous response
+			if response, ok := x.getGroupInfo(node.Group, item.Source.Path); ok {
+
+				// Get id from the body or headers and set value
+				valJSON, err := extractValue(item.Source.Key, response.Header, []byte(response.Body), x.rand)
+				if err != nil || valJSON == nil {
 					continue
 				}
 
-				selected[random] = true
+				switch value.GetKind().(type) {
 
-			}
+				case *structpb.Value_NumberValue:
+					if valJSON.Type() == fastjson.TypeString {
 
-		}
+						// e.g. the id of Location
+						if f, err := strconv.ParseFloat(string(valJSON.GetStringBytes()), 64); err == nil {
+							*value = *structpb.NewNumberValue(f)
+						}
 
-		// Execute our strategy
-		for i, value := range values {
+					} else if int(valJSON.GetFloat64()) > valJSON.GetInt() {
 
-			// Set dependencies values
-			if x.isRelated(node.Path, keys[i]) {
+						*value = *structpb.NewNumberValue(valJSON.GetFloat64())
 
-				for _, item := range x.dependency.Paths[node.Path].Items {
+					} else {
 
-					// Get id from the previous response
-					if body, ok := (*x.groupInfo)[node.Group][item.Source.Path]; ok {
+						*value = *structpb.NewNumberValue(float64(valJSON.GetInt()))
 
-						// Convert dependency.yml item.Source.Key to fastjson keys
-						keys := []string{}
-						key := ""
-						for _, c := range item.Source.Key {
+					}
 
-							if c == '{' {
+				case *structpb.Value_StringValue:
 
-								keys = append(keys, key)
-								key = ""
+					v, err := structpb.NewValue([]byte(getExtractedString(valJSON)))
+					if err != nil {
+						panic(err)
+					}
 
-							} else if c == '[' {
+					*value = *structpb.NewStringValue(v.GetStringValue())
 
-								keys = append(keys, key)
-								key = ""
-								key += "0"
+				}
 
-							} else if c == ']' || c == '}' {
+			}
 
-								if len(key) > 0 {
-									keys = append(keys, key)
-									key = ""
-								}
+		}
 
-							} else {
+	}
 
-								key += string(c)
+}
 
-							}
+func (x *HsuanFuzz) adoptStrategies() {
 
-						}
+	x.mutated = map[*base.Node][]string{}
+	x.fills = map[*base.Node][]*fill{}
 
-						// Get id from JSON and set value
-						valJSON := fastjson.MustParse(body).Get(keys...)
+	for _, node := range x.grammar.Nodes {
 
-						switch value.GetKind().(type) {
+		values := []*structpb.Value{}
+		keys := []string{}
+		types := []string{}
 
-						case *structpb.Value_NumberValue:
-							if int(valJSON.GetFloat64()) > valJSON.GetInt() {
+		// Get all request values
+		for _, request := range node.Requests {
 
-								*value = *structpb.NewNumberValue(valJSON.GetFloat64())
+			for _, k := range getSortedKeys(request.Value) {
 
-							} else {
+				v := request.Value.GetFields()[k]
+				ks, vs := getKeyValue(k, v)
+				keys = append(keys, ks...)
+				values = append(values, vs...)
+				for range ks {
+					types = append(types, request.Type)
+				}
 
-								*value = *structpb.NewNumberValue(float64(valJSON.GetInt()))
+			}
 
-							}
+		}
 
-						case *structpb.Value_StringValue:
+		// Choose two parameters to modify
+		selected := map[int]bool{}
 
-							v, err := structpb.NewValue(valJSON.GetStringBytes())
-							if err != nil {
-								panic(err)
-							}
+		if len(values) >= 2 {
 
-							*value = *structpb.NewStringValue(v.GetStringValue())
+			record := -1
 
-						}
+			for len(selected) < 2 {
 
-					}
+				random := x.rand.Intn(len(values))
 
+				if record == random {
+					continue
 				}
 
+				selected[random] = true
+
+			}
+
+		}
+
+		// Execute our strategy
+		for i, value := range values {
+
+			// Set dependencies values
+			x.setDependency(node, keys[i], value)
+
+			// Try a value of the responses instead of mutating it, to learn the dependency
+			if x.Learn && !x.isRelated(node.Path, keys[i]) && isLearnable(types[i], keys[i]) && x.rand.Intn(2) == 0 {
+				if source := x.fillFromPool(node, keys[i], value); source != nil {
+					x.fills[node] = append(x.fills[node], &fill{key: keys[i], source: source})
+					continue
+				}
 			}
 
 			// If it is not being selected to the value
@@ -315,12 +380,14 @@ func (x *HsuanFuzz) adoptStrategies() {
 				}
 			}
 
+			// Record the mutated parameter for crash buckets
+			x.mutated[node] = append(x.mutated[node], keys[i])
+
 			// Get value of string type
 			v := x.getStringValue(value, true, false)
 
 			// Determine how to modify
-			rand.Seed(time.Now().UnixNano())
-			random := rand.Intn(5)
+			random := x.rand.Intn(5)
 
 			if random == 0 {
 
@@ -348,8 +415,7 @@ func (x *HsuanFuzz) adoptStrategies() {
 
 				//NULL?
 				//Change type
-				rand.Seed(time.Now().UnixNano())
-				random = rand.Intn(2)
+				random = x.rand.Intn(2)
 
 				switch value.GetKind().(type) {
 
@@ -403,8 +469,7 @@ func (x *HsuanFuzz) adoptStrategies() {
 			} else {
 
 				//Mutate
-				mu := gofuzz.NewMutator()
-				mv := mu.Mutate([]byte(v))
+				mv := x.mutator.Mutate([]byte(v))
 
 				switch value.GetKind().(type) {
 
@@ -0,0 +1,217 @@
+package hsuanfuzz
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/iasthc/hsuan-fuzz/internal/base"
+)
+
+// Node is the grammar node which is sent as one request.
+type Node = base.Node
+
+// Severity presents how serious a finding is.
+type Severity int
+
+// Severities of findings.
+const (
+	SeverityInfo Severity = iota
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityLow:
+		return "low"
+	case SeverityMedium:
+		return "medium"
+	case SeverityHigh:
+		return "high"
+	case SeverityCritical:
+		return "critical"
+	}
+	return strconv.Itoa(int(s))
+}
+
+// Finding is a bug reported by an oracle.
+type Finding struct {
+	Oracle   string
+	Category string
+	Severity Severity
+	Message  string
+}
+
+// Oracle decides whether a response reveals a bug.
+// The body of req can be read again by req.GetBody, req is nil when the request cannot be built.
+type Oracle interface {
+	Name() string
+	Check(node *Node, req *http.Request, info *ResponseInfo) []*Finding
+}
+
+// ActiveOracle is an oracle which sends the node again in other ways to decide, e.g. as another principal.
+// Probe is called with a nil info before the node is sent, and again with the response of the node.
+type ActiveOracle interface {
+	Oracle
+	Probe(ctx context.Context, node *Node, info *ResponseInfo) []*Probe
+}
+
+// Probe is a request sent by an active oracle, and the findings of its response.
+type Probe struct {
+	Info     *ResponseInfo
+	Findings []*Finding
+}
+
+// ServerErrorOracle reports responses with status code 5xx.
+type ServerErrorOracle struct{}
+
+// Name implements Oracle.
+func (ServerErrorOracle) Name() string {
+	return "server-error"
+}
+
+// Check implements Oracle.
+func (o ServerErrorOracle) Check(node *Node, req *http.Request, info *ResponseInfo) []*Finding {
+
+	if info.Code >= 500 && info.Code != 599 {
+		return []*Finding{{Oracle: o.Name(), Category: "crash", Severity: SeverityHigh, Message: "status code " + strconv.Itoa(info.Code)}}
+	}
+
+	return nil
+}
+
+var errorLeakPatterns = map[string]*regexp.Regexp{
+	"stack trace":     regexp.MustCompile(`(?m)(^\s+at [\w$.]+\(|Traceback \(most recent call last\)|goroutine \d+ \[|\.(rb|php|py|js|java|go):\d+)`),
+	"sql error":       regexp.MustCompile(`(?i)(sql syntax|syntax error at or near|sqlstate|ORA-\d{5}|sqlite3?::|pg::)`),
+	"exception class": regexp.MustCompile(`\b[A-Z]\w+(Exception|Error)\b:`),
+}
+
+// ErrorLeakOracle reports responses which leak stack traces or database errors.
+type ErrorLeakOracle struct{}
+
+// Name implements Oracle.
+func (ErrorLeakOracle) Name() string {
+	return "error-leak"
+}
+
+// Check implements Oracle.
+func (o ErrorLeakOracle) Check(node *Node, req *http.Request, info *ResponseInfo) []*Finding {
+
+	findings := []*Finding{}
+	for _, name := range []string{"stack trace", "sql error", "exception class"} {
+		if errorLeakPatterns[name].MatchString(info.Body) {
+			findings = append(findings, &Finding{Oracle: o.Name(), Category: "information-disclosure", Severity: SeverityMedium, Message: name + " in response body"})
+		}
+	}
+
+	return findings
+}
+
+// EnableOracle appends the built-in oracle of name to the oracles of HsuanFuzz.
+func (x *HsuanFuzz) EnableOracle(name string) error {
+
+	var o Oracle
+	switch name {
+	case "server-error":
+		o = ServerErrorOracle{}
+	case "error-leak":
+		o = ErrorLeakOracle{}
+	case "schema":
+		o = NewSchemaOracle(x.openAPI)
+	case "undocumented":
+		o = NewUndocumentedOracle(x.openAPI)
+	case "bola":
+		o = NewBOLAOracle(x)
+	case "auth-bypass":
+		o = NewAuthBypassOracle(x)
+	default:
+		return errors.New("unknown oracle " + name)
+	}
+
+	for _, enabled := range x.Oracles {
+		if enabled.Name() == name {
+			return nil
+		}
+	}
+	x.Oracles = append(x.Oracles, o)
+
+	return nil
+}
+
+// EnableOracles enables the built-in oracles of a comma-separated list, and replaces the enabled ones.
+func (x *HsuanFuzz) EnableOracles(names string) error {
+
+	x.Oracles = nil
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if err := x.EnableOracle(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// check runs all oracles against the response.
+func (x *HsuanFuzz) check(node *base.Node, info *ResponseInfo) []*Finding {
+
+	findings := []*Finding{}
+	for _, o := range x.Oracles {
+		findings = append(findings, o.Check(node, info.raw, info)...)
+	}
+
+	return findings
+}
+
+// probe runs all active oracles, info is nil before the node is sent.
+func (x *HsuanFuzz) probe(ctx context.Context, node *base.Node, info *ResponseInfo) []*Probe {
+
+	probes := []*Probe{}
+	for _, o := range x.Oracles {
+		if a, ok := o.(ActiveOracle); ok {
+			probes = append(probes, a.Probe(ctx, node, info)...)
+		}
+	}
+
+	return probes
+}
+
+// sendChecked sends the node between the probes of active oracles, and returns its response with the findings of all oracles.
+func (x *HsuanFuzz) sendChecked(ctx context.Context, node *base.Node) (*ResponseInfo, []*Finding) {
+
+	info, probes := x.sendProbed(ctx, node, true)
+
+	findings := []*Finding{}
+	for _, p := range probes {
+		findings = append(findings, p.Findings...)
+	}
+
+	return info, findings
+}
+
+// sendProbed sends the node between the probes of active oracles, the last probe is the node with the findings of all oracles.
+// The response is saved as the source of dependencies only when record is set, see sendAs.
+// A throttled, timed out or canceled node is not checked and not probed again, the probes sent before it are kept.
+func (x *HsuanFuzz) sendProbed(ctx context.Context, node *base.Node, record bool) (*ResponseInfo, []*Probe) {
+
+	probes := x.probe(ctx, node, nil)
+	info := x.sendAs(ctx, node, true, &x.Token, record)
+	if info.Throttled || info.Timeout || info.Canceled {
+		return info, append(probes, &Probe{Info: info})
+	}
+
+	probes = append(probes, x.probe(ctx, node, info)...)
+	probes = append(probes, &Probe{Info: info, Findings: x.check(node, info)})
+
+	return info, probes
+}
@@ -0,0 +1,376 @@
+package hsuanfuzz
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/iasthc/hsuan-fuzz/internal/base"
+	gofuzz "github.com/iasthc/hsuan-fuzz/internal/go-fuzz"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gopkg.in/yaml.v2"
+)
+
+// Info is the grammar of an iteration, which is a corpus entry.
+type Info = base.Info
+
+// readableInfo is the YAML form of base.Info, strings are decoded from base64.
+type readableInfo struct {
+	Nodes []*readableNode `yaml:"nodes"`
+}
+
+type readableNode struct {
+	Group    uint32             `yaml:"group"`
+	Path     string             `yaml:"path"`
+	Method   string             `yaml:"method"`
+	Requests []*readableRequest `yaml:"requests"`
+}
+
+type readableRequest struct {
+	Type  string                 `yaml:"type"`
+	Value map[string]interface{} `yaml:"value"`
+}
+
+// decodeValue converts the value for display, strings are decoded from base64.
+func decodeValue(v *structpb.Value) interface{} {
+
+	switch v.GetKind().(type) {
+
+	case *structpb.Value_StringValue:
+
+		data, err := base64.StdEncoding.DecodeString(v.GetStringValue())
+		if err != nil {
+			return v.GetStringValue()
+		}
+		return string(data)
+
+	case *structpb.Value_ListValue:
+
+		vs := []interface{}{}
+		for _, e := range v.GetListValue().GetValues() {
+			vs = append(vs, decodeValue(e))
+		}
+		return vs
+
+	case *structpb.Value_StructValue:
+
+		m := map[string]interface{}{}
+		for k, e := range v.GetStructValue().GetFields() {
+			m[k] = decodeValue(e)
+		}
+		return m
+
+	}
+
+	return v.AsInterface()
+}
+
+// encodeValue converts the decoded YAML value back, strings are encoded to base64.
+func encodeValue(v interface{}) interface{} {
+
+	switch v := v.(type) {
+
+	case string:
+		if v == "" {
+			return v
+		}
+		return base64.StdEncoding.EncodeToString([]byte(v))
+
+	case []interface{}:
+		vs := []interface{}{}
+		for _, e := range v {
+			vs = append(vs, encodeValue(e))
+		}
+		return vs
+
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, e := range v {
+			m[fmt.Sprint(k)] = encodeValue(e)
+		}
+		return m
+
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for k, e := range v {
+			m[k] = encodeValue(e)
+		}
+		return m
+
+	}
+
+	return v
+}
+
+// MarshalReadable converts the info to YAML with decoded strings, for review and hand-editing.
+func MarshalReadable(info *Info) ([]byte, error) {
+
+	r := readableInfo{}
+	for _, node := range info.Nodes {
+
+		n := &readableNode{Group: node.Group, Path: node.Path, Method: node.Method}
+		for _, request := range node.Requests {
+			n.Requests = append(n.Requests, &readableRequest{Type: request.Type, Value: decodeValue(structpb.NewStructValue(request.Value)).(map[string]interface{})})
+		}
+		r.Nodes = append(r.Nodes, n)
+
+	}
+
+	return yaml.Marshal(r)
+}
+
+// UnmarshalReadable converts the YAML of MarshalReadable back to the info.
+func UnmarshalReadable(b []byte) (*Info, error) {
+
+	r := readableInfo{}
+	if err := yaml.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+
+	info := &base.Info{}
+	for _, n := range r.Nodes {
+
+		node := &base.Node{Group: n.Group, Path: n.Path, Method: n.Method}
+		for _, request := range n.Requests {
+
+			value, err := structpb.NewStruct(encodeValue(request.Value).(map[string]interface{}))
+			if err != nil {
+				return nil, err
+			}
+			node.Requests = append(node.Requests, &base.Request{Type: request.Type, Value: value})
+
+		}
+		info.Nodes = append(info.Nodes, node)
+
+	}
+
+	return info, nil
+}
+
+// addCorpus saves the info as a new corpus entry with its readable form.
+func (x *HsuanFuzz) addCorpus(info *base.Info) {
+
+	// Deterministic, so the same info is the same entry
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(info)
+	if err != nil {
+		panic(err)
+	}
+
+	if x.corpus.Add(gofuzz.Artifact{Data: b}) {
+		x.addReadable(b, info)
+	}
+
+}
+
+func (x *HsuanFuzz) addReadable(data []byte, info *base.Info) {
+
+	r, err := MarshalReadable(info)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	x.corpus.AddDescription(data, r, "yml")
+
+}
+
+// getSeedFiles returns the YAML seeds of the directory.
+func getSeedFiles(dir string) []string {
+
+	files := []string{}
+	for _, pattern := range []string{"*.yml", "*.yaml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	return files
+}
+
+// isReadableForm reports whether the YAML file of the corpus is the readable form of its entry, not written or edited by hand.
+func isReadableForm(file string, info *base.Info) bool {
+
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	if _, err := hex.DecodeString(name); err != nil {
+		return false
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(filepath.Dir(file), name))
+	if err != nil {
+		return false
+	}
+
+	original := base.Info{}
+	if err := proto.Unmarshal(b, &original); err != nil {
+		return false
+	}
+
+	return proto.Equal(&original, info)
+}
+
+// getEditedSeeds returns the names of the YAML seeds of the corpus directory which are written or edited by hand.
+func getEditedSeeds(dir string) []string {
+
+	edited := []string{}
+	for _, file := range getSeedFiles(dir) {
+
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+
+		info, err := UnmarshalReadable(b)
+		if err != nil || !isReadableForm(file, info) {
+			edited = append(edited, filepath.Base(file))
+		}
+
+	}
+
+	return edited
+}
+
+// EditedSeedsError presents the seeds of the corpus written or edited by hand, which would be lost when the corpus is deleted.
+type EditedSeedsError struct {
+	Files    []string
+	SeedsDir string
+}
+
+func (e *EditedSeedsError) Error() string {
+	return "the corpus has seeds written or edited by hand: " + strings.Join(e.Files, ", ") + "\nmove them to " + e.SeedsDir + " or keep the corpus"
+}
+
+// SeedsDir returns the directory of the imported and hand-written seeds in YAML, they are added to the corpus of every campaign.
+func (x *HsuanFuzz) SeedsDir() string {
+	return x.dirPath + "seeds"
+}
+
+// importReadable writes the readable form of every corpus entry, and adds the hand-written or edited YAML seeds to the corpus.
+// The seeds of SeedsDir are added as well, since the corpus is deleted by New unless it is kept.
+func (x *HsuanFuzz) importReadable() {
+
+	// Corpus entries of previous campaigns
+	sigs := []gofuzz.Sig{}
+	for sig := range x.corpus.M {
+		sigs = append(sigs, sig)
+	}
+	sort.Slice(sigs, func(i, j int) bool {
+		return hex.EncodeToString(sigs[i][:]) < hex.EncodeToString(sigs[j][:])
+	})
+
+	for _, sig := range sigs {
+
+		info := base.Info{}
+		if err := proto.Unmarshal(x.corpus.M[sig].Data, &info); err != nil {
+			log.Println(err)
+			continue
+		}
+		x.addReadable(x.corpus.M[sig].Data, &info)
+
+	}
+
+	// Seeds in YAML
+	for _, file := range append(getSeedFiles(x.corpus.Dir()), getSeedFiles(x.SeedsDir())...) {
+
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		info, err := UnmarshalReadable(b)
+		if err != nil || len(info.Nodes) == 0 {
+			log.Println("invalid seed", file, err)
+			continue
+		}
+
+		// Skip the readable form which is not edited
+		if isReadableForm(file, info) {
+			continue
+		}
+
+		x.addCorpus(info)
+
+	}
+
+}
+
+// CorpusDir returns the directory of the corpus.
+func (x *HsuanFuzz) CorpusDir() string {
+	return x.corpus.Dir()
+}
+
+// ReadInfo reads a corpus entry, a readable seed (.yml or .yaml) or a crasher (.node or .minimized) as info.
+func ReadInfo(file string) (*Info, error) {
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	switch filepath.Ext(file) {
+
+	case ".yml", ".yaml":
+		return UnmarshalReadable(b)
+
+	case ".node", ".minimized":
+		node := base.Node{}
+		if err := proto.Unmarshal(b, &node); err != nil {
+			return nil, err
+		}
+		return &base.Info{Nodes: []*base.Node{&node}}, nil
+
+	}
+
+	info := base.Info{}
+	if err := proto.Unmarshal(b, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// FormatInfo pretty-prints the info grouped by group and operation.
+func FormatInfo(info *Info) string {
+
+	s := ""
+	group := uint32(0)
+	operation := ""
+	for i, node := range info.Nodes {
+
+		if i == 0 || node.Group != group {
+			group = node.Group
+			operation = ""
+			s += fmt.Sprintf("group %d\n", group)
+		}
+
+		if op := node.Method + " " + node.Path; op != operation {
+			operation = op
+			s += "  " + op + "\n"
+		}
+
+		s += fmt.Sprintf("    #%d\n", i)
+		for _, request := range node.Requests {
+			b, err := yaml.Marshal(decodeValue(structpb.NewStructValue(request.Value)))
+			if err != nil {
+				continue
+			}
+			s += "      " + request.Type + ":\n"
+			for _, line := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+				s += "        " + line + "\n"
+			}
+		}
+
+	}
+
+	return s
+}
@@ -0,0 +1,130 @@
+package hsuanfuzz
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/iasthc/hsuan-fuzz/internal/base"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// newTestNode returns a node of one request, the strings of value are encoded to base64 as in the grammar.
+func newTestNode(t *testing.T, path string, method string, requestType string, value map[string]interface{}) *base.Node {
+
+	s, err := structpb.NewStruct(encodeValue(value).(map[string]interface{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &base.Node{Group: 1, Path: path, Method: method, Requests: []*base.Request{{Type: requestType, Value: s}}}
+}
+
+func TestReadableRoundTrip(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		value map[string]interface{}
+	}{
+		{"empty", map[string]interface{}{}},
+		{"scalars", map[string]interface{}{"name": "app", "count": 3.0, "price": 1.5, "ok": true, "none": nil}},
+		{"empty string", map[string]interface{}{"name": ""}},
+		{"unicode", map[string]interface{}{"name": "名前 ✓"}},
+		{"control bytes", map[string]interface{}{"name": "a\x00b\nc\t"}},
+		{"invalid UTF-8", map[string]interface{}{"name": "\xff\xfe"}},
+		{"YAML look-alikes", map[string]interface{}{"a": "true", "b": "123", "c": "null", "d": "- x", "e": "k: v"}},
+		{"nested", map[string]interface{}{"user": map[string]interface{}{"tags": []interface{}{"x", 2.0, []interface{}{}}, "address": map[string]interface{}{}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			info := &base.Info{Nodes: []*base.Node{
+				newTestNode(t, "/items", "POST", "application/json", tt.value),
+				newTestNode(t, "/items/{id}", "GET", "path", map[string]interface{}{"id": "7"}),
+			}}
+
+			b, err := MarshalReadable(info)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := UnmarshalReadable(b)
+			if err != nil {
+				t.Fatalf("%v\n%s", err, b)
+			}
+
+			if !proto.Equal(info, got) {
+				t.Errorf("round trip of\n%s\ngot %v, want %v", b, got, info)
+			}
+
+		})
+	}
+
+}
+
+func TestReadableDecodedStrings(t *testing.T) {
+
+	info := &base.Info{Nodes: []*base.Node{newTestNode(t, "/items", "POST", "application/json", map[string]interface{}{"name": "hello"})}}
+
+	b, err := MarshalReadable(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reviewers see the values which are sent, not base64
+	if !strings.Contains(string(b), "name: hello") || strings.Contains(string(b), base64.StdEncoding.EncodeToString([]byte("hello"))) {
+		t.Errorf("strings are not decoded:\n%s", b)
+	}
+
+}
+
+func TestUnmarshalReadableEdited(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		yaml    string
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			"hand-written seed",
+			"nodes:\n- group: 2\n  path: /items\n  method: POST\n  requests:\n  - type: application/json\n    value:\n      name: edited\n      count: 10\n",
+			map[string]interface{}{"name": "edited", "count": 10.0},
+			false,
+		},
+		{
+			"integer keys of nested maps",
+			"nodes:\n- path: /items\n  method: POST\n  requests:\n  - type: application/json\n    value:\n      codes:\n        1: one\n",
+			map[string]interface{}{"codes": map[string]interface{}{"1": "one"}},
+			false,
+		},
+		{
+			"invalid YAML",
+			"nodes: [",
+			nil,
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			info, err := UnmarshalReadable([]byte(tt.yaml))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			want := newTestNode(t, "/items", "POST", "application/json", tt.want)
+			if got := info.Nodes[0].Requests[0].Value; !proto.Equal(got, want.Requests[0].Value) {
+				t.Errorf("got %v, want %v", got, want.Requests[0].Value)
+			}
+
+		})
+	}
+
+}
@@ -0,0 +1,233 @@
+package hsuanfuzz
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/iasthc/hsuan-fuzz/internal/base"
+	"google.golang.org/protobuf/proto"
+)
+
+// ReplayResult presents the response of a replayed node and whether its finding still reproduces.
+type ReplayResult struct {
+	Name         string
+	Node         *base.Node
+	Info         *ResponseInfo
+	Findings     []*Finding
+	Expected     *Finding // the finding saved with the crasher, nil for corpus entries
+	Reproduced   bool
+	Inconclusive bool // no answer of the target, e.g. a transport error, timeout or throttling, so it is neither reproduced nor fixed
+}
+
+// Replay sends the node again, with a fresh token and the requests of its producers first.
+func (x *HsuanFuzz) Replay(node *base.Node) *ReplayResult {
+	return x.ReplayContext(context.Background(), node)
+}
+
+// ReplayContext is the same as Replay, but the requests are canceled when ctx is done.
+func (x *HsuanFuzz) ReplayContext(ctx context.Context, node *base.Node) *ReplayResult {
+
+	if err := x.ensureTokens(ctx); err != nil {
+		log.Println(err)
+	}
+
+	node = proto.Clone(node).(*base.Node)
+	x.sendProducers(ctx, node)
+	x.setDependencies(node)
+
+	info, findings := x.sendChecked(ctx, node)
+
+	return &ReplayResult{Node: node, Info: info, Findings: findings, Inconclusive: ctx.Err() != nil || isUnanswered(info)}
+}
+
+// isUnanswered reports whether the response is not the behaviour of the target, 599 is a transport error of the sender.
+func isUnanswered(info *ResponseInfo) bool {
+	return info.Code == 599 || info.Timeout || info.Throttled || info.Canceled
+}
+
+// sendProducers sends the POST requests of the paths which the node depends on, so their responses are saved in the group.
+func (x *HsuanFuzz) sendProducers(ctx context.Context, node *base.Node) {
+
+	if !x.strictMode || x.dependency.Paths[node.Path] == nil {
+		return
+	}
+
+	for _, path := range x.getOperationFlows(x.dependency.Paths[node.Path]) {
+
+		producers := x.newNode(node.Group, path, http.MethodPost)
+		if len(producers) == 0 {
+			continue
+		}
+
+		x.setDependencies(producers[0])
+		x.SendRequestContext(ctx, producers[0], true)
+
+	}
+
+}
+
+// setDependencies sets all dependency values of the node from the responses of its group.
+func (x *HsuanFuzz) setDependencies(node *base.Node) {
+
+	for _, request := range node.Requests {
+		for _, k := range getSortedKeys(request.Value) {
+			ks, vs := getKeyValue(k, request.Value.GetFields()[k])
+			for i := range vs {
+				x.setDependency(node, ks[i], vs[i])
+			}
+		}
+	}
+
+}
+
+// ReplayFile replays a crasher (.node or .minimized), a corpus entry or readable seed, or every crasher of a directory.
+func (x *HsuanFuzz) ReplayFile(p string) ([]*ReplayResult, error) {
+	return x.ReplayFileContext(context.Background(), p)
+}
+
+// ReplayFileContext is the same as ReplayFile, but the requests are canceled when ctx is done.
+func (x *HsuanFuzz) ReplayFileContext(ctx context.Context, p string) ([]*ReplayResult, error) {
+
+	if err := x.initClient(); err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{p}
+	if stat.IsDir() {
+		files, err = filepath.Glob(filepath.Join(p, "*.node"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+	}
+
+	results := []*ReplayResult{}
+	for _, file := range files {
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		rs, err := x.replayFile(ctx, file)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, rs...)
+
+	}
+
+	return results, nil
+}
+
+func (x *HsuanFuzz) replayFile(ctx context.Context, file string) ([]*ReplayResult, error) {
+
+	ext := filepath.Ext(file)
+
+	// Corpus entry
+	if ext != ".node" && ext != ".minimized" {
+
+		info, err := ReadInfo(file)
+		if err != nil {
+			return nil, err
+		}
+
+		results := []*ReplayResult{}
+		for _, node := range info.Nodes {
+			r := x.ReplayContext(ctx, node)
+			r.Name = file
+			results = append(results, r)
+		}
+
+		return results, nil
+	}
+
+	// Crasher
+	info, err := ReadInfo(file)
+	if err != nil {
+		return nil, err
+	}
+	node := info.Nodes[0]
+	if len(node.Path) == 0 {
+		return nil, errors.New("invalid crasher " + file)
+	}
+
+	r := x.ReplayContext(ctx, node)
+	r.Name = file
+
+	r.Expected = readFinding(strings.TrimSuffix(file, ext))
+
+	if r.Expected != nil && !r.Inconclusive {
+		r.Reproduced = isSameFinding(r.Findings, r.Expected)
+	}
+
+	return []*ReplayResult{r}, nil
+}
+
+// readFinding returns the finding saved with the crasher of the prefix, nil when it is not a crasher.
+// Crashers saved before oracles only have the status code.
+func readFinding(prefix string) *Finding {
+
+	if oracle, err := ioutil.ReadFile(prefix + ".oracle"); err == nil {
+		category, _ := ioutil.ReadFile(prefix + ".category")
+		message, _ := ioutil.ReadFile(prefix + ".message")
+		return &Finding{Oracle: string(oracle), Category: string(category), Message: string(message)}
+	}
+
+	if _, err := os.Stat(prefix + ".code"); err == nil {
+		return &Finding{Oracle: ServerErrorOracle{}.Name(), Category: "crash"}
+	}
+
+	return nil
+}
+
+// isSameFinding reports whether one of the findings is of the oracle and category of f.
+func isSameFinding(findings []*Finding, f *Finding) bool {
+
+	for _, finding := range findings {
+		if finding.Oracle == f.Oracle && finding.Category == f.Category {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CrashersDir returns the directory of the crashers.
+func (x *HsuanFuzz) CrashersDir() string {
+	return x.crashers.Dir()
+}
+
+// RefreshToken gets new tokens of all principals in strict mode.
+func (x *HsuanFuzz) RefreshToken() error {
+
+	if err := x.initClient(); err != nil {
+		return err
+	}
+
+	x.tokenMu.Lock()
+	defer x.tokenMu.Unlock()
+
+	x.setJars()
+
+	for _, t := range x.getTokens() {
+		if x.isRefreshable(t) {
+			if err := x.login(context.Background(), t); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
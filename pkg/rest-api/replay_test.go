@@ -0,0 +1,76 @@
+package hsuanfuzz
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReplayFileCrasher(t *testing.T) {
+
+	tests := []struct {
+		name             string
+		fixed            bool
+		down             bool
+		wantReproduced   bool
+		wantInconclusive bool
+	}{
+		{"still failing", false, false, true, false},
+		{"fixed", true, false, false, false},
+		{"target is down", false, true, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// The server fails until the replay of the fixed case
+			fixed := false
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !fixed {
+					http.Error(w, "boom", http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"id":"1"}`))
+			}))
+			defer server.Close()
+
+			x := newTestCampaign(t, server.URL, testItemsPaths)
+			x.Oracles = []Oracle{ServerErrorOracle{}}
+
+			node := newTestNode(t, "/items", http.MethodPost, "application/json", map[string]interface{}{"name": "app"})
+			info, findings := x.sendChecked(context.Background(), node)
+			if len(findings) != 1 {
+				t.Fatalf("got the findings %v of %d, want one", findings, info.Code)
+			}
+			if _, isNew := x.saveCrasher(node, info, findings[0]); !isNew {
+				t.Fatal("the crasher is not new")
+			}
+
+			fixed = tt.fixed
+			if tt.down {
+				server.Close()
+			}
+
+			results, err := x.ReplayFile(x.CrashersDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 1 {
+				t.Fatalf("got %d results, want one of the crasher", len(results))
+			}
+
+			r := results[0]
+			if r.Expected == nil || r.Expected.Oracle != (ServerErrorOracle{}).Name() {
+				t.Errorf("got the expected finding %v of the crasher", r.Expected)
+			}
+			if r.Reproduced != tt.wantReproduced || r.Inconclusive != tt.wantInconclusive {
+				t.Errorf("got reproduced %v and inconclusive %v, want %v and %v: %d %s", r.Reproduced, r.Inconclusive, tt.wantReproduced, tt.wantInconclusive, r.Info.Code, r.Info.Body)
+			}
+
+		})
+	}
+
+}
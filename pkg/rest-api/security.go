@@ -0,0 +1,331 @@
+package hsuanfuzz
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/valyala/fastjson"
+)
+
+// Credential presents the secret of a security scheme of the specification, see Token.Schemes.
+type Credential struct {
+	Value        string   `yaml:"value"`    // apiKey or bearer, the token of Token is used when empty
+	Prefix       string   `yaml:"prefix"`   // prefix of bearer, "Bearer" by default
+	Username     string   `yaml:"username"` // http basic and oauth2 password flow
+	Password     string   `yaml:"password"`
+	ClientID     string   `yaml:"client_id"` // oauth2
+	ClientSecret string   `yaml:"client_secret"`
+	Scopes       []string `yaml:"scopes"`
+	TokenURL     string   `yaml:"token_url"` // overrides the tokenUrl of the oauth2 flow
+	token        string   // obtained from the oauth2 flow
+	expiry       time.Time
+}
+
+// getCredentialValue returns the token of the credential, the value entered first, then the one obtained from oauth2, then the token of t.
+func getCredentialValue(t *Token, c *Credential) string {
+
+	if c != nil {
+		if c.Value != "" {
+			return c.Value
+		}
+		if c.token != "" {
+			return c.token
+		}
+	}
+
+	return t.Bearer
+}
+
+// hasCredentials reports whether a credential of the security schemes is entered.
+func hasCredentials(t *Token) bool {
+
+	for _, c := range t.Schemes {
+		if c != nil && (c.Value != "" || c.Username != "" || c.ClientID != "") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getSecurityScheme returns the security scheme of the name in the components of the specification.
+func (x *HsuanFuzz) getSecurityScheme(name string) *openapi3.SecurityScheme {
+
+	if ref, ok := x.openAPI.Components.SecuritySchemes[name]; ok && ref != nil {
+		return ref.Value
+	}
+
+	return nil
+}
+
+// getSecurityRequirement returns the security requirement of the operation which t can satisfy.
+// Declared is false when neither the operation nor the specification declares security, then the token is sent as before.
+func (x *HsuanFuzz) getSecurityRequirement(node *Node, t *Token) (requirement openapi3.SecurityRequirement, declared bool) {
+
+	operation := getOperation(x.openAPI, node)
+	if operation == nil {
+		return nil, false
+	}
+
+	requirements := x.openAPI.Security
+	if operation.Security != nil {
+		requirements = *operation.Security
+	} else if len(requirements) == 0 {
+		return nil, false
+	}
+
+	// Requirements are alternatives, an empty one makes the security optional
+	optional := false
+	for _, r := range requirements {
+
+		if len(r) == 0 {
+			optional = true
+			continue
+		}
+
+		satisfied := true
+		for name := range r {
+			if !x.canAuthorize(name, t) {
+				satisfied = false
+				break
+			}
+		}
+		if satisfied {
+			return r, true
+		}
+
+	}
+
+	if optional || len(requirements) == 0 {
+		return nil, true
+	}
+
+	// Send the first one anyway, the server decides
+	return requirements[0], true
+}
+
+// canAuthorize reports whether t has the credential of the security scheme.
+func (x *HsuanFuzz) canAuthorize(name string, t *Token) bool {
+
+	scheme := x.getSecurityScheme(name)
+	if scheme == nil {
+		return false
+	}
+
+	c := t.Schemes[name]
+	if scheme.Type == "http" && strings.EqualFold(scheme.Scheme, "basic") {
+		return c != nil && c.Username != ""
+	}
+
+	return getCredentialValue(t, c) != ""
+}
+
+// authorize sets the credentials of t required by the operation of the node, and returns the cookies to be added.
+// The location of the credential is moved when Token.In is set, e.g. to test if the server accepts it elsewhere.
+func (x *HsuanFuzz) authorize(node *Node, t *Token, query url.Values, header http.Header) []*http.Cookie {
+
+	requirement, declared := x.getSecurityRequirement(node, t)
+
+	// The specification does not use security schemes
+	if !declared {
+		if t.Bearer != "" {
+			if t.In == "query" {
+				query.Set("Authorization", t.Bearer)
+			} else {
+				// header.Set("Authorization", "Token "+x.Token.Bearer)
+				header.Set("Authorization", "Bearer "+t.Bearer)
+			}
+		}
+		return nil
+	}
+
+	names := []string{}
+	for name := range requirement {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cookies := []*http.Cookie{}
+	for _, name := range names {
+
+		scheme := x.getSecurityScheme(name)
+		if scheme == nil {
+			continue
+		}
+		c := t.Schemes[name]
+
+		in, key, value := "header", "Authorization", ""
+		switch strings.ToLower(scheme.Type) {
+
+		case "http":
+
+			if strings.EqualFold(scheme.Scheme, "basic") {
+				if c != nil && c.Username != "" {
+					value = "Basic " + base64.StdEncoding.EncodeToString([]byte(c.Username+":"+c.Password))
+				}
+			} else if v := getCredentialValue(t, c); v != "" {
+				prefix := "Bearer"
+				if c != nil && c.Prefix != "" {
+					prefix = c.Prefix
+				}
+				value = prefix + " " + v
+			}
+
+		case "apikey":
+
+			in, key, value = scheme.In, scheme.Name, getCredentialValue(t, c)
+
+		default:
+
+			// oauth2 and openIdConnect
+			if v := getCredentialValue(t, c); v != "" {
+				value = "Bearer " + v
+			}
+
+		}
+
+		if value == "" {
+			continue
+		}
+
+		if t.In != "" && t.In != in {
+			in = t.In
+			value = strings.TrimPrefix(value, "Bearer ")
+		}
+
+		switch in {
+		case openapi3.ParameterInQuery:
+			query.Set(key, value)
+		case openapi3.ParameterInCookie:
+			cookies = append(cookies, &http.Cookie{Name: key, Value: value})
+		default:
+			header.Set(key, value)
+		}
+
+	}
+
+	return cookies
+}
+
+// getCredentialLocation returns where the credential of the security scheme is sent, header, query or cookie.
+func (x *HsuanFuzz) getCredentialLocation(name string) string {
+
+	if scheme := x.getSecurityScheme(name); scheme != nil && strings.EqualFold(scheme.Type, "apiKey") {
+		return scheme.In
+	}
+
+	return openapi3.ParameterInHeader
+}
+
+// refreshCredentials gets the tokens of the oauth2 schemes of t.
+func (x *HsuanFuzz) refreshCredentials(t *Token) error {
+
+	names := []string{}
+	for name := range t.Schemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+
+		scheme := x.getSecurityScheme(name)
+		c := t.Schemes[name]
+		if scheme == nil || c == nil || scheme.Type != "oauth2" || c.Value != "" {
+			continue
+		}
+
+		token, expiry, err := x.getOAuth2Token(scheme, c)
+		if err != nil {
+			return errors.New(name + ": " + err.Error())
+		}
+		c.token, c.expiry = token, expiry
+
+	}
+
+	return nil
+}
+
+// getOAuth2Token requests an access token by the password flow when the username is set, otherwise by the client credentials flow.
+func (x *HsuanFuzz) getOAuth2Token(scheme *openapi3.SecurityScheme, c *Credential) (string, time.Time, error) {
+
+	form := url.Values{}
+	var flow *openapi3.OAuthFlow
+	if scheme.Flows != nil {
+		if c.Username != "" && scheme.Flows.Password != nil {
+			flow = scheme.Flows.Password
+		} else if scheme.Flows.ClientCredentials != nil {
+			flow = scheme.Flows.ClientCredentials
+		}
+	}
+
+	if c.Username != "" {
+		form.Set("grant_type", "password")
+		form.Set("username", c.Username)
+		form.Set("password", c.Password)
+	} else {
+		form.Set("grant_type", "client_credentials")
+	}
+	if c.ClientID != "" {
+		form.Set("client_id", c.ClientID)
+	}
+	if c.ClientSecret != "" {
+		form.Set("client_secret", c.ClientSecret)
+	}
+	if len(c.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.Scopes, " "))
+	}
+
+	tokenURL := c.TokenURL
+	if tokenURL == "" && flow != nil {
+		tokenURL = flow.TokenURL
+	}
+	if tokenURL == "" {
+		return "", time.Time{}, errors.New("no token url of the oauth2 flow")
+	}
+
+	// Relative to the server
+	if u, err := url.Parse(tokenURL); err == nil && !u.IsAbs() {
+		tokenURL = strings.TrimRight(x.server, "/") + "/" + strings.TrimLeft(tokenURL, "/")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := x.getClient().Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return "", time.Time{}, errors.New("invalid oauth2 token response, code: " + res.Status)
+	}
+
+	parsed, err := fastjson.ParseBytes(b)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	token := string(parsed.GetStringBytes("access_token"))
+	if token == "" {
+		return "", time.Time{}, errors.New("no access_token in the oauth2 token response")
+	}
+
+	return token, getExpiry(parsed, token, 0), nil
+}
@@ -1,6 +1,7 @@
 package hsuanfuzz
 
 import (
+	"context"
 	"encoding/base64"
 	"io/ioutil"
 	"log"
@@ -15,26 +16,147 @@ import (
 
 // ResponseInfo is used to carry request and response information.
 type ResponseInfo struct {
-	request *base.Node
-	Code    int
-	Type    string
-	Body    string
+	request   *base.Node
+	raw       *http.Request
+	Code      int
+	Type      string
+	Header    http.Header
+	Body      string
+	Throttled bool   // rate limited by the target, not the target behaviour
+	Timeout   bool   // no response within the timeouts of Transport
+	Canceled  bool   // the context was done before the response was read, e.g. the budget is exhausted
+	principal string // name of the principal of an active oracle which sent the request, empty for the owner
 }
 
 // SendRequest uses our grammar to send the request.
 func (x *HsuanFuzz) SendRequest(node *base.Node, decode bool) *ResponseInfo {
+	return x.SendRequestContext(context.Background(), node, decode)
+}
+
+// SendRequestContext is the same as SendRequest, but the request is canceled when ctx is done.
+func (x *HsuanFuzz) SendRequestContext(ctx context.Context, node *base.Node, decode bool) *ResponseInfo {
+	return x.sendAs(ctx, node, decode, &x.Token, true)
+}
+
+// sendAs sends the node with the credentials of the principal t.
+// Only the responses of x.Token, the owner of the resources, are saved as the sources of dependencies, and only when record is set.
+// A 401 of x.Token refreshes it and sends the node once more, the probes of the other principals and of the synthetic credentials are never retried,
+// since their 401 is the answer the oracles look for.
+func (x *HsuanFuzz) sendAs(ctx context.Context, node *base.Node, decode bool, t *Token, record bool) *ResponseInfo {
 
-	// time.Sleep(100 * time.Millisecond)
+	generation := x.getGeneration(t)
+
+	req, err := x.newRequest(ctx, node, decode, t)
+	if err != nil {
+		log.Println(err)
+		return &ResponseInfo{
+			request: node,
+			Code:    599,
+			Body:    err.Error(),
+		}
+	}
+
+	/* Response */
+	res, err := x.getClientAs(t).Do(req)
+	if err == nil && res.StatusCode == http.StatusUnauthorized && t == &x.Token && x.isRefreshable(t) {
+
+		renewed, renewErr := x.renewToken(ctx, t, generation)
+		if renewErr != nil {
+			log.Println(renewErr)
+		}
+
+		if renewed {
+			if retry, retryErr := x.newRequest(ctx, node, decode, t); retryErr == nil {
+				res.Body.Close()
+				req = retry
+				res, err = x.getClientAs(t).Do(req)
+			}
+		}
+
+	}
+	if err != nil {
+		return getErrorInfo(ctx, node, req, err)
+	}
+	defer res.Body.Close()
+
+	// The timeouts and the context cover the body as well
+	resBytes, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return getErrorInfo(ctx, node, req, err)
+	}
+	resBody := string(resBytes)
+
+	/* Save response to fuzzer */
+	if record && t == &x.Token && res.StatusCode/100 == 2 {
+		if strings.Contains(strings.ToLower(res.Header.Get("Content-Type")), "json") {
+			x.setGroupInfo(node.Group, node.Path, res.Header, resBody)
+			x.addPool(node.Path, resBody)
+		} else {
+			// Headers such as Location and ETag
+			x.setGroupInfo(node.Group, node.Path, res.Header, "")
+		}
+	}
+
+	return &ResponseInfo{
+		request:   node,
+		raw:       req,
+		Code:      res.StatusCode,
+		Type:      res.Header.Get("Content-Type"),
+		Header:    res.Header,
+		Body:      resBody,
+		Throttled: isThrottled(res),
+	}
+}
+
+// getErrorInfo returns the response info of a request which got no complete response.
+// Canceled requests are not the target behaviour, timeouts are counted apart, and the other errors are 599.
+func getErrorInfo(ctx context.Context, node *base.Node, req *http.Request, err error) *ResponseInfo {
+
+	if ctx.Err() != nil {
+		return &ResponseInfo{
+			request:  node,
+			raw:      req,
+			Code:     599,
+			Body:     err.Error(),
+			Canceled: true,
+		}
+	}
+
+	log.Println(err)
+	if isTimeout(err) {
+		return &ResponseInfo{
+			request: node,
+			raw:     req,
+			Body:    err.Error(),
+			Timeout: true,
+		}
+	}
+
+	return &ResponseInfo{
+		request: node,
+		raw:     req,
+		Code:    599,
+		Body:    err.Error(),
+	}
+}
+
+// NewRequest builds the HTTP request of the node, which is exactly what SendRequest sends.
+func (x *HsuanFuzz) NewRequest(ctx context.Context, node *base.Node, decode bool) (*http.Request, error) {
+	return x.newRequest(ctx, node, decode, &x.Token)
+}
+
+func (x *HsuanFuzz) newRequest(ctx context.Context, node *base.Node, decode bool, t *Token) (*http.Request, error) {
 
 	u := url.URL{}
 	u.Path = node.Path
 	query := u.Query()
 	header := http.Header{}
+	params := []*http.Cookie{}
 	body := ""
 
 	for _, request := range node.Requests {
 
-		if request.Type == openapi3.ParameterInPath || request.Type == openapi3.ParameterInQuery || request.Type == openapi3.ParameterInHeader {
+		if request.Type == openapi3.ParameterInPath || request.Type == openapi3.ParameterInQuery || request.Type == openapi3.ParameterInHeader || request.Type == openapi3.ParameterInCookie {
 
 			for k, v := range request.Value.GetFields() {
 
@@ -53,6 +175,10 @@ func (x *HsuanFuzz) SendRequest(node *base.Node, decode bool) *ResponseInfo {
 
 					header.Set(k, value)
 
+				} else if request.Type == openapi3.ParameterInCookie {
+
+					params = append(params, &http.Cookie{Name: k, Value: getCookieValue(value)})
+
 				}
 
 			}
@@ -92,30 +218,18 @@ func (x *HsuanFuzz) SendRequest(node *base.Node, decode bool) *ResponseInfo {
 	}
 
 	/* Security */
-	if x.Token.Bearer != "" {
-		if x.Token.In == "query" {
-			query.Set("Authorization", x.Token.Bearer)
-		} else {
-			// header.Set("Authorization", "Token "+x.Token.Bearer)
-			header.Set("Authorization", "Bearer "+x.Token.Bearer)
-		}
-	}
+	x.tokenMu.RLock()
+	cookies := x.authorize(node, t, query, header)
+	x.tokenMu.RUnlock()
 
 	// log.Println((x.server + url.PathEscape(u.Path) + "?" + query.Encode()))
 	// log.Println(strings.NewReader(body))
 	// p := url.PathEscape(x.server + u.Path)
 	// p = strings.ReplaceAll(p, "%2F", "/")
 	/* New Request */
-	req, err := http.NewRequest(node.Method, (x.server + u.Path + "?" + query.Encode()), strings.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, node.Method, (x.server + u.Path + "?" + query.Encode()), strings.NewReader(body))
 	if err != nil {
-		log.Println(err)
-		if x.strictMode {
-			return &ResponseInfo{
-				request: node,
-				Code:    599,
-				Body:    err.Error(),
-			}
-		}
+		return nil, err
 	}
 
 	// Set header
@@ -124,41 +238,54 @@ func (x *HsuanFuzz) SendRequest(node *base.Node, decode bool) *ResponseInfo {
 			req.Header.Set(k, v)
 		}
 	}
+	for _, cookie := range append(params, cookies...) {
+		req.AddCookie(cookie)
+	}
 
-	/* Response */
-	client := &http.Client{}
-	res, err := client.Do(req)
-	if err != nil {
-		log.Println(err)
-		return &ResponseInfo{
-			request: node,
-			Code:    599,
-			Body:    err.Error(),
+	return req, nil
+}
+
+// getCookieValue percent-encodes the value when it has bytes which are not allowed in a cookie, which net/http would drop.
+func getCookieValue(v string) string {
+
+	for i := 0; i < len(v); i++ {
+		if b := v[i]; b <= 0x20 || b >= 0x7f || b == '"' || b == ',' || b == ';' || b == '\\' {
+			return url.QueryEscape(v)
 		}
 	}
-	defer res.Body.Close()
 
-	resBytes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		panic(err)
-	}
-	resBody := string(resBytes)
+	return v
+}
 
-	/* Save response to fuzzer */
-	if res.StatusCode/100 == 2 {
-		if strings.Contains(strings.ToLower(res.Header.Get("Content-Type")), "json") {
-			if (*x.groupInfo)[node.Group] == nil {
-				(*x.groupInfo)[node.Group] = make(map[string]string)
-			}
+// groupResponse is the latest successful response of a path in a group.
+type groupResponse struct {
+	Header http.Header
+	Body   string // JSON, empty when the response is not JSON
+}
 
-			(*x.groupInfo)[node.Group][node.Path] = string(resBytes)
-		}
+// setGroupInfo saves the response of the path in the group, it is safe for concurrent use.
+// The JSON body of an earlier response is kept when the body is empty.
+func (x *HsuanFuzz) setGroupInfo(group uint32, path string, header http.Header, body string) {
+	x.groupMu.Lock()
+	defer x.groupMu.Unlock()
+
+	if (*x.groupInfo)[group] == nil {
+		(*x.groupInfo)[group] = make(map[string]*groupResponse)
 	}
 
-	return &ResponseInfo{
-		request: node,
-		Code:    res.StatusCode,
-		Type:    res.Header.Get("Content-Type"),
-		Body:    resBody,
+	if previous, ok := (*x.groupInfo)[group][path]; ok && body == "" {
+		body = previous.Body
 	}
+
+	(*x.groupInfo)[group][path] = &groupResponse{Header: header, Body: body}
+}
+
+// getGroupInfo returns the response of the path in the group, it is safe for concurrent use.
+func (x *HsuanFuzz) getGroupInfo(group uint32, path string) (*groupResponse, bool) {
+	x.groupMu.RLock()
+	defer x.groupMu.RUnlock()
+
+	response, ok := (*x.groupInfo)[group][path]
+
+	return response, ok
 }
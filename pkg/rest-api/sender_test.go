@@ -0,0 +1,105 @@
+package hsuanfuzz
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/iasthc/hsuan-fuzz/internal/base"
+)
+
+const testSenderSpec = `
+openapi: 3.0.0
+info: {title: Test, version: "1"}
+servers: [{url: "http://api.local"}]
+paths:
+  /items:
+    get: {responses: {"200": {description: ok}}}
+`
+
+func TestSendAsStalledBody(t *testing.T) {
+
+	// The headers are sent at once, the body never comes
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	tests := []struct {
+		name         string
+		timeout      time.Duration
+		cancel       time.Duration
+		wantTimeout  bool
+		wantCanceled bool
+	}{
+		{"timeout of the transport", 50 * time.Millisecond, 0, true, false},
+		{"canceled context", 0, 50 * time.Millisecond, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			x := newTestFuzz(t, testSenderSpec)
+			x.server = server.URL
+			x.Transport.Timeout = tt.timeout
+			x.Oracles = []Oracle{ServerErrorOracle{}}
+			if err := x.initClient(); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			if tt.cancel > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.cancel)
+				defer cancel()
+			}
+
+			info := x.sendAs(ctx, &base.Node{Group: 1, Path: "/items", Method: http.MethodGet}, true, &x.Token, false)
+			if info.Timeout != tt.wantTimeout || info.Canceled != tt.wantCanceled {
+				t.Errorf("got timeout %v and canceled %v, want %v and %v: %d %s", info.Timeout, info.Canceled, tt.wantTimeout, tt.wantCanceled, info.Code, info.Body)
+			}
+
+			// Neither is a finding of the server
+			if findings := x.check(info.request, info); len(findings) > 0 {
+				t.Errorf("got the findings %v", findings)
+			}
+
+		})
+	}
+
+}
+
+func TestSendGroupsCountsTimeouts(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	x := newTestFuzz(t, testSenderSpec)
+	x.server = server.URL
+	x.Transport.Timeout = 50 * time.Millisecond
+	x.Oracles = []Oracle{ServerErrorOracle{}}
+	x.grammar = &base.Info{Nodes: []*base.Node{{Group: 1, Path: "/items", Method: http.MethodGet}}}
+
+	c := newCampaign()
+	if infos := x.sendGroups(context.Background(), c, Options{}); len(infos[1]) != 0 {
+		t.Errorf("got the responses %v of timeouts", infos[1])
+	}
+	if c.timeouts != 1 || len(c.crashers) != 0 {
+		t.Errorf("got %d timeouts and %d crashers, want 1 and 0", c.timeouts, len(c.crashers))
+	}
+
+}
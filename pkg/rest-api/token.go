@@ -1,43 +1,72 @@
 package hsuanfuzz
 
 import (
-	"crypto/tls"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
+	"net/http/cookiejar"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/valyala/fastjson"
 	"gopkg.in/yaml.v2"
 )
 
+// tokenMargin is how long before the expiry a token is refreshed.
+const tokenMargin = 10 * time.Second
+
 // Token is used to manually enter service authorization information.
 type Token struct {
-	URL         string      `yaml:"url"`
-	Method      string      `yaml:"method"`
-	Key         string      `yaml:"key"`
-	Bearer      string      `yaml:"bearer"` // is empty when initial
-	ContentType string      `yaml:"type"`
-	Body        interface{} `yaml:"body"`
-	Hardcode    bool        `yaml:"hardcode"`
-	In          string      `yaml:"in"`
+	URL         string                 `yaml:"url"`
+	Method      string                 `yaml:"method"`
+	Key         string                 `yaml:"key"`
+	Bearer      string                 `yaml:"bearer"` // is empty when initial
+	ContentType string                 `yaml:"type"`
+	Body        interface{}            `yaml:"body"`
+	Hardcode    bool                   `yaml:"hardcode"`
+	In          string                 `yaml:"in"`
+	Name        string                 `yaml:"name"`       // name of the principal
+	Admin       bool                   `yaml:"admin"`      // may reach the resources of other principals
+	Principals  []*Token               `yaml:"principals"` // other principals, the resources are created with the token above
+	Schemes     map[string]*Credential `yaml:"schemes"`    // credentials of the security schemes of the specification
+	TTL         time.Duration          `yaml:"ttl"`        // lifetime of the token when the response has no expires_in and it is not a JWT
+	Session     bool                   `yaml:"session"`    // the log in sets a session cookie instead of returning a token
+	expiry      time.Time              // zero when the lifetime is unknown
+	generation  int                    // incremented by each refresh
+	obtained    time.Time
+	jar         http.CookieJar // cookies of the log in and the responses, see HsuanFuzz.CookieJar
 }
 
-// GetToken obtains the authorization key based on the input information.
-func GetToken(t Token, print bool) string {
+// GetToken obtains the authorization key based on the input information, with the Transport of the requests.
+func (x *HsuanFuzz) GetToken(t Token, print bool) (string, error) {
+
+	if err := x.initClient(); err != nil {
+		return "", err
+	}
+
+	bearer, _, err := getToken(t, print, x.getClient())
+
+	return bearer, err
+
+}
 
-	/* For https */
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+// getToken logs in, and returns the token with its expiry, which is zero when unknown.
+func getToken(t Token, print bool, client *http.Client) (string, time.Time, error) {
 
 	// hardcode
 	if t.Hardcode {
-		return t.Bearer
+		return t.Bearer, time.Time{}, nil
 	}
 
 	b, err := yaml.Marshal(t.Body)
 	if err != nil {
-		panic(err)
+		return "", time.Time{}, err
 	}
 
 	body := string(b)
@@ -48,78 +77,255 @@ func GetToken(t Token, print bool) string {
 
 	req, err := http.NewRequest(t.Method, t.URL, strings.NewReader(body))
 	if err != nil {
-		panic(err)
+		return "", time.Time{}, err
 	}
 
 	if t.ContentType != "" {
 		req.Header.Set("Content-Type", t.ContentType)
 	}
 
-	client := &http.Client{}
 	res, err := client.Do(req)
 	if err != nil {
-		panic(err)
+		return "", time.Time{}, err
 	}
 	defer res.Body.Close()
 
+	// The session cookie is kept by the cookie jar of the client
+	if t.Session {
+		if res.StatusCode/100 != 2 && res.StatusCode/100 != 3 {
+			return "", time.Time{}, errors.New("Invalid log in, code: " + strconv.Itoa(res.StatusCode))
+		}
+		return "", getExpiry(nil, "", t.TTL), nil
+	}
+
 	if res.StatusCode != http.StatusOK {
-		panic("Invalid log in, code: " + strconv.Itoa(res.StatusCode))
+		return "", time.Time{}, errors.New("Invalid log in, code: " + strconv.Itoa(res.StatusCode))
 	}
 
 	b, err = ioutil.ReadAll(res.Body)
 	if err != nil {
-		panic(err)
+		return "", time.Time{}, err
+	}
+
+	/* Customized token info */
+	/* SPREE: access_token */
+	/* REALWORLD: user{token} */
+	v, err := extractValue(t.Key, res.Header, b, nil)
+	if err != nil {
+		return "", time.Time{}, err
 	}
 
-	// fastjson keys
-	keys := []string{}
-	key := ""
-	for _, c := range t.Key {
+	bearer := ""
+	if v != nil && v.Type() == fastjson.TypeString {
+		bearer = string(v.GetStringBytes())
+	}
 
-		if c == '{' {
+	if bearer == "" {
 
-			keys = append(keys, key)
-			key = ""
+		/* MAGENTO: w/o key */
+		bearer = strings.ReplaceAll(string(b), "\"", "")
 
-		} else if c == '[' {
+	}
+
+	if print {
+		fmt.Println(bearer)
+	}
 
-			keys = append(keys, key)
-			key = ""
-			key += "0"
+	// expires_in
+	parsed, _ := fastjson.ParseBytes(b)
 
-		} else if c == ']' || c == '}' {
+	return bearer, getExpiry(parsed, bearer, t.TTL), nil
 
-			if len(key) > 0 {
-				keys = append(keys, key)
-				key = ""
+}
+
+// getExpiry returns when the token expires, from expires_in of the response, then exp of the JWT, then the TTL.
+func getExpiry(res *fastjson.Value, bearer string, ttl time.Duration) time.Time {
+
+	if res != nil {
+		if v := res.Get("expires_in"); v != nil {
+			seconds, err := v.Float64()
+			if err != nil {
+				seconds, err = strconv.ParseFloat(string(v.GetStringBytes()), 64)
 			}
+			if err == nil && seconds > 0 {
+				return time.Now().Add(time.Duration(seconds * float64(time.Second)))
+			}
+		}
+	}
 
-		} else {
+	if parts := strings.Split(bearer, "."); len(parts) == 3 {
+		if b, err := base64.RawURLEncoding.DecodeString(parts[1]); err == nil {
+			claims := struct {
+				Exp float64 `json:"exp"`
+			}{}
+			if err := json.Unmarshal(b, &claims); err == nil && claims.Exp > 0 {
+				return time.Unix(int64(claims.Exp), 0)
+			}
+		}
+	}
+
+	if ttl > 0 {
+		return time.Now().Add(ttl)
+	}
 
-			key += string(c)
+	return time.Time{}
+}
+
+// isRefreshable reports whether the token of t is obtained by logging in, so it can be refreshed.
+func (x *HsuanFuzz) isRefreshable(t *Token) bool {
 
+	if !x.strictMode {
+		return false
+	}
+
+	if t.URL != "" && !t.Hardcode {
+		return true
+	}
+
+	for name, c := range t.Schemes {
+		if scheme := x.getSecurityScheme(name); scheme != nil && scheme.Type == "oauth2" && c != nil && c.Value == "" {
+			return true
 		}
+	}
+
+	return false
+}
 
+// isExpired reports whether the token of t or one of its oauth2 credentials expires soon.
+func isExpired(t *Token) bool {
+
+	expiries := []time.Time{t.expiry}
+	for _, c := range t.Schemes {
+		if c != nil {
+			expiries = append(expiries, c.expiry)
+		}
 	}
 
-	/* Customized token info */
-	v := fastjson.MustParseBytes(b).Get(keys...)
+	for _, expiry := range expiries {
+		if !expiry.IsZero() && time.Now().Add(tokenMargin).After(expiry) {
+			return true
+		}
+	}
 
-	/* SPREE: access_token */
-	/* REALWORLD: user{token} */
-	bearer := string(v.GetStringBytes())
+	return false
+}
 
-	if bearer == "" {
+// login refreshes the tokens of t, failures are retried with backoff.
+// The caller holds tokenMu.
+func (x *HsuanFuzz) login(ctx context.Context, t *Token) error {
 
-		/* MAGENTO: w/o key */
-		bearer = strings.ReplaceAll(string(b), "\"", "")
+	backoff := x.Politeness.Backoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	maxBackoff := x.Politeness.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = time.Minute
+	}
+
+	for retry := 0; ; retry++ {
+
+		err := func() error {
+
+			if t.URL != "" && !t.Hardcode {
+				bearer, expiry, err := getToken(*t, false, x.getClientAs(t))
+				if err != nil {
+					return err
+				}
+				t.Bearer, t.expiry = bearer, expiry
+			}
+
+			return x.refreshCredentials(t)
+
+		}()
+
+		if err == nil {
+			t.generation++
+			t.obtained = time.Now()
+			return nil
+		}
+
+		if retry >= x.Politeness.MaxRetries {
+			return errors.New("log in as " + getPrincipalName(t, "owner") + ": " + err.Error())
+		}
+		log.Println("log in as", getPrincipalName(t, "owner"), "failed, retry in", backoff, err)
+
+		if err := sleep(ctx, backoff); err != nil {
+			return err
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
 
 	}
 
-	if print {
-		fmt.Println(bearer)
+}
+
+// getTokens returns the owner and the other principals.
+func (x *HsuanFuzz) getTokens() []*Token {
+	return append([]*Token{&x.Token}, x.Token.Principals...)
+}
+
+// ensureTokens logs in as the principals which have no token yet or whose token expires soon.
+func (x *HsuanFuzz) ensureTokens(ctx context.Context) error {
+
+	x.tokenMu.Lock()
+	defer x.tokenMu.Unlock()
+
+	x.setJars()
+
+	for _, t := range x.getTokens() {
+		if x.isRefreshable(t) && (t.generation == 0 || isExpired(t)) {
+			if err := x.login(ctx, t); err != nil {
+				return err
+			}
+		}
 	}
 
-	return bearer
+	return nil
+}
+
+// setJars creates the cookie jars of the principals, the caller holds tokenMu.
+func (x *HsuanFuzz) setJars() {
+
+	for _, t := range x.getTokens() {
+		if t.jar == nil && (x.CookieJar || t.Session) {
+			// Only fails with invalid options
+			t.jar, _ = cookiejar.New(nil)
+		}
+	}
+
+}
+
+// renewToken logs in as t again after a 401, unless another request has already done so since generation.
+// A token just obtained is kept, since the 401 is the target behaviour then, e.g. of another principal.
+// It reports whether the token differs from the one of generation.
+func (x *HsuanFuzz) renewToken(ctx context.Context, t *Token, generation int) (bool, error) {
+
+	x.tokenMu.Lock()
+	defer x.tokenMu.Unlock()
+
+	if t.generation != generation {
+		return true, nil
+	}
+
+	if time.Since(t.obtained) < tokenMargin {
+		return false, nil
+	}
+
+	if err := x.login(ctx, t); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// getGeneration returns how many times the token of t has been refreshed.
+func (x *HsuanFuzz) getGeneration(t *Token) int {
+
+	x.tokenMu.RLock()
+	defer x.tokenMu.RUnlock()
 
+	return t.generation
 }
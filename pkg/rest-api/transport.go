@@ -0,0 +1,148 @@
+package hsuanfuzz
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Transport presents the HTTP settings shared by all requests, zero values mean the defaults of net/http.
+type Transport struct {
+	DialTimeout           time.Duration `yaml:"dial"`
+	TLSHandshakeTimeout   time.Duration `yaml:"tls"`
+	ResponseHeaderTimeout time.Duration `yaml:"header"`
+	Timeout               time.Duration `yaml:"total"`
+	MaxIdleConns          int           `yaml:"idle"`
+	MaxIdleConnsPerHost   int           `yaml:"idlePerHost"`
+	IdleConnTimeout       time.Duration `yaml:"idleTimeout"`
+	DisableKeepAlives     bool          `yaml:"disableKeepAlives"`
+	Proxy                 string        `yaml:"proxy"`    // empty means the environment proxy
+	CAFiles               []string      `yaml:"ca"`       // PEM bundles appended to the system pool
+	CertFile              string        `yaml:"cert"`     // client certificate for mTLS
+	KeyFile               string        `yaml:"key"`      // client key for mTLS
+	InsecureSkipVerify    bool          `yaml:"insecure"` // explicit opt-out of TLS verification
+}
+
+// build creates the http.Transport of the settings.
+func (t *Transport) build() (*http.Transport, error) {
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if t.DialTimeout > 0 {
+		dialer.Timeout = t.DialTimeout
+	}
+	tr.DialContext = dialer.DialContext
+
+	if t.TLSHandshakeTimeout > 0 {
+		tr.TLSHandshakeTimeout = t.TLSHandshakeTimeout
+	}
+	if t.ResponseHeaderTimeout > 0 {
+		tr.ResponseHeaderTimeout = t.ResponseHeaderTimeout
+	}
+	if t.MaxIdleConns > 0 {
+		tr.MaxIdleConns = t.MaxIdleConns
+	}
+	if t.MaxIdleConnsPerHost > 0 {
+		tr.MaxIdleConnsPerHost = t.MaxIdleConnsPerHost
+	}
+	if t.IdleConnTimeout > 0 {
+		tr.IdleConnTimeout = t.IdleConnTimeout
+	}
+	tr.DisableKeepAlives = t.DisableKeepAlives
+
+	if t.Proxy != "" {
+		u, err := url.Parse(t.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		tr.Proxy = http.ProxyURL(u)
+	}
+
+	config := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+
+	if len(t.CAFiles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, p := range t.CAFiles {
+			b, err := ioutil.ReadFile(p)
+			if err != nil {
+				return nil, err
+			}
+			if !pool.AppendCertsFromPEM(b) {
+				return nil, errors.New("invalid CA bundle " + p)
+			}
+		}
+		config.RootCAs = pool
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	tr.TLSClientConfig = config
+
+	return tr, nil
+}
+
+// initClient builds the client shared by all requests, Transport and Politeness are read on the first call.
+// It returns the error of the settings, e.g. an invalid CA bundle, client certificate or proxy.
+func (x *HsuanFuzz) initClient() error {
+	x.clientOnce.Do(func() {
+		tr, err := x.Transport.build()
+		if err != nil {
+			x.clientErr = err
+			x.client = &http.Client{Transport: errorTransport{err}}
+			return
+		}
+		x.client = &http.Client{Transport: newPoliteTransport(tr, x.Politeness), Timeout: x.Transport.Timeout}
+	})
+	return x.clientErr
+}
+
+// getClient returns the client shared by all requests, the requests fail with the error of initClient.
+func (x *HsuanFuzz) getClient() *http.Client {
+	x.initClient()
+	return x.client
+}
+
+// errorTransport fails every request, it replaces the transport of invalid settings.
+type errorTransport struct {
+	err error
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t errorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return nil, t.err
+}
+
+// getClientAs returns the client of the principal t, which keeps its cookies when it has a cookie jar.
+func (x *HsuanFuzz) getClientAs(t *Token) *http.Client {
+
+	client := x.getClient()
+	if t.jar == nil {
+		return client
+	}
+
+	return &http.Client{Transport: client.Transport, Jar: t.jar, Timeout: client.Timeout}
+}
+
+// isTimeout reports whether the error of a request is caused by one of the timeouts.
+func isTimeout(err error) bool {
+	var e net.Error
+	return errors.As(err, &e) && e.Timeout()
+}
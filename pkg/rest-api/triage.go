@@ -0,0 +1,275 @@
+package hsuanfuzz
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iasthc/hsuan-fuzz/internal/base"
+	gofuzz "github.com/iasthc/hsuan-fuzz/internal/go-fuzz"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	reUUID   = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+	reHex    = regexp.MustCompile(`(?i)\b(0x)?[0-9a-f]{8,}\b`)
+	reTime   = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`)
+	reNumber = regexp.MustCompile(`\d+`)
+	reSpace  = regexp.MustCompile(`\s+`)
+)
+
+// maxSignatureBody is the length of the normalized response body used by the signature.
+const maxSignatureBody = 2048
+
+// Bucket groups the findings of the same root cause.
+type Bucket struct {
+	Signature string    `yaml:"signature"`
+	Operation string    `yaml:"operation"`
+	Code      int       `yaml:"code"`
+	Oracle    string    `yaml:"oracle"`
+	Category  string    `yaml:"category"`
+	Severity  string    `yaml:"severity"`
+	Message   string    `yaml:"message"`
+	Parameter string    `yaml:"parameter"`
+	Hits      int       `yaml:"hits"`
+	FirstSeen time.Time `yaml:"first"`
+	LastSeen  time.Time `yaml:"last"`
+}
+
+// ID returns the name of the bucket files in the crashers directory.
+func (b *Bucket) ID() string {
+	sig := gofuzz.Hash([]byte(b.Signature))
+	return hex.EncodeToString(sig[:])
+}
+
+// normalizeJSON strips the volatile parts of the strings of JSON, as normalizeText does, and replaces the numbers.
+func normalizeJSON(v interface{}, inputs []string) interface{} {
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = normalizeJSON(e, inputs)
+		}
+		return v
+	case []interface{}:
+		// Elements of the same array are the same resource
+		if len(v) > 0 {
+			return []interface{}{normalizeJSON(v[0], inputs)}
+		}
+		return v
+	case string:
+		return normalizeText(v, inputs)
+	case float64:
+		return "<n>"
+	}
+
+	return v
+}
+
+// normalizeBody strips the echoed inputs, IDs, timestamps and numbers, so only the stack frames and error messages are left.
+// The values of JSON bodies are normalized one by one, the keys are kept.
+func normalizeBody(body string, inputs []string) string {
+
+	normalized := ""
+
+	var v interface{}
+	if err := json.Unmarshal([]byte(body), &v); err == nil {
+		if _, ok := v.(string); !ok {
+			// The placeholders are not escaped
+			b := &bytes.Buffer{}
+			encoder := json.NewEncoder(b)
+			encoder.SetEscapeHTML(false)
+			if err := encoder.Encode(normalizeJSON(v, inputs)); err == nil {
+				normalized = strings.TrimSpace(b.String())
+			}
+		}
+	}
+
+	if normalized == "" {
+		normalized = normalizeText(body, inputs)
+	}
+
+	if len(normalized) > maxSignatureBody {
+		normalized = normalized[:maxSignatureBody]
+	}
+
+	return normalized
+}
+
+// normalizeText replaces the echoed inputs, UUIDs, hex IDs, timestamps and numbers of the text.
+func normalizeText(s string, inputs []string) string {
+
+	// Longer inputs first, so a short input does not break a long one
+	inputs = append([]string{}, inputs...)
+	sort.Slice(inputs, func(i, j int) bool {
+		return len(inputs[i]) > len(inputs[j])
+	})
+	for _, input := range inputs {
+		if len(input) >= 3 {
+			s = strings.ReplaceAll(s, input, "<input>")
+		}
+	}
+
+	s = reUUID.ReplaceAllString(s, "<id>")
+	s = reTime.ReplaceAllString(s, "<time>")
+	s = reHex.ReplaceAllStringFunc(s, func(h string) string {
+		if strings.ContainsAny(h, "0123456789") {
+			return "<id>"
+		}
+		return h
+	})
+	s = reNumber.ReplaceAllString(s, "<n>")
+
+	return strings.TrimSpace(reSpace.ReplaceAllString(s, " "))
+}
+
+// getInputs returns the decoded string values sent by the node.
+func (x *HsuanFuzz) getInputs(node *base.Node) []string {
+
+	inputs := []string{}
+	for _, request := range node.Requests {
+		for _, k := range getSortedKeys(request.Value) {
+			_, vs := getKeyValue(k, request.Value.GetFields()[k])
+			for _, v := range vs {
+				inputs = append(inputs, x.getStringValue(v, true, false))
+			}
+		}
+	}
+
+	return inputs
+}
+
+// getBucket returns the bucket of the finding, it is not saved yet.
+func (x *HsuanFuzz) getBucket(node *base.Node, info *ResponseInfo, finding *Finding) *Bucket {
+	return x.newBucket(node, info, finding, x.mutated[node])
+}
+
+// newBucket returns the bucket of the finding with the mutated parameters of the node.
+func (x *HsuanFuzz) newBucket(node *base.Node, info *ResponseInfo, finding *Finding, mutated []string) *Bucket {
+
+	parameters := append([]string{}, mutated...)
+	sort.Strings(parameters)
+
+	b := &Bucket{
+		Operation: node.Method + " " + node.Path,
+		Code:      info.Code,
+		Oracle:    finding.Oracle,
+		Category:  finding.Category,
+		Severity:  finding.Severity.String(),
+		Message:   finding.Message,
+		Parameter: strings.Join(parameters, ","),
+	}
+
+	b.Signature = strings.Join([]string{
+		b.Operation,
+		strconv.Itoa(b.Code),
+		b.Oracle,
+		b.Category,
+		normalizeBody(b.Message, nil),
+		b.Parameter,
+		normalizeBody(info.Body, x.getInputs(node)),
+	}, "\n")
+
+	return b
+}
+
+// saveCrasher counts the finding in its bucket, and writes the node with its request and response when the bucket is new.
+// It returns the name of the bucket and whether it is new.
+func (x *HsuanFuzz) saveCrasher(node *base.Node, info *ResponseInfo, finding *Finding) (string, bool) {
+
+	x.bucketMu.Lock()
+	defer x.bucketMu.Unlock()
+
+	t := time.Now()
+	b := x.getBucket(node, info, finding)
+	name := b.Signature
+
+	old, exist := x.buckets[name]
+	if exist {
+
+		b = old
+
+	} else {
+
+		b.FirstSeen = t
+		x.buckets[name] = b
+
+		n, err := proto.Marshal(node)
+		if err != nil {
+			panic(err)
+		}
+
+		x.crashers.AddDescription([]byte(name), []byte(strconv.Itoa(info.Code)), "code")
+		x.crashers.AddDescription([]byte(name), []byte(t.Format("20060102 150405")), "timestamp")
+		x.crashers.AddDescription([]byte(name), n, "node")
+		if r, err := MarshalReadable(&base.Info{Nodes: []*base.Node{node}}); err == nil {
+			x.crashers.AddDescription([]byte(name), r, "yml")
+		}
+		x.crashers.AddDescription([]byte(name), []byte(info.request.String()), "request")
+		x.crashers.AddDescription([]byte(name), []byte(info.Body), "response")
+		x.crashers.AddDescription([]byte(name), []byte(finding.Oracle), "oracle")
+		x.crashers.AddDescription([]byte(name), []byte(finding.Category), "category")
+		x.crashers.AddDescription([]byte(name), []byte(finding.Severity.String()), "severity")
+		x.crashers.AddDescription([]byte(name), []byte(finding.Message), "message")
+		if info.principal != "" {
+			x.crashers.AddDescription([]byte(name), []byte(info.principal), "principal")
+		}
+		x.saveExports(name, node, info, finding)
+
+	}
+
+	b.Hits++
+	b.LastSeen = t
+
+	encoded, err := yaml.Marshal(b)
+	if err != nil {
+		panic(err)
+	}
+	x.crashers.SetDescription([]byte(name), encoded, "bucket")
+
+	return name, !exist
+}
+
+// loadBuckets reads the buckets of previous campaigns from the crashers directory.
+func (x *HsuanFuzz) loadBuckets() map[string]*Bucket {
+
+	buckets := map[string]*Bucket{}
+	for _, data := range x.crashers.ReadDescriptions("bucket") {
+
+		b := &Bucket{}
+		if err := yaml.Unmarshal(data, b); err != nil || b.Signature == "" {
+			continue
+		}
+		buckets[b.Signature] = b
+
+	}
+
+	return buckets
+}
+
+// Buckets returns all crash buckets, the most hit first.
+func (x *HsuanFuzz) Buckets() []*Bucket {
+
+	x.bucketMu.Lock()
+	defer x.bucketMu.Unlock()
+
+	buckets := []*Bucket{}
+	for _, b := range x.buckets {
+		buckets = append(buckets, b)
+	}
+
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].Hits != buckets[j].Hits {
+			return buckets[i].Hits > buckets[j].Hits
+		}
+		return buckets[i].FirstSeen.Before(buckets[j].FirstSeen)
+	})
+
+	return buckets
+}
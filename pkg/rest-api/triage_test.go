@@ -0,0 +1,81 @@
+package hsuanfuzz
+
+import "testing"
+
+func TestNormalizeBody(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		body   string
+		inputs []string
+		want   string
+	}{
+		{
+			"text ids and numbers",
+			"user 7f1c2a3b-0000-4a4a-8b8b-0123456789ab not found at 0xdeadbeef12, line 42",
+			nil,
+			"user <id> not found at <id>, line <n>",
+		},
+		{
+			"text timestamp",
+			"2026-10-18T05:32:52.123Z panic: nil map",
+			nil,
+			"<time> panic: nil map",
+		},
+		{
+			"text inputs, longer first",
+			"invalid name abcdef and abc",
+			[]string{"abc", "abcdef", "ab"},
+			"invalid name <input> and <input>",
+		},
+		{
+			"JSON keeps the messages",
+			`{"error":"division by zero","id":12,"at":"2026-10-18 05:32:52"}`,
+			nil,
+			`{"at":"<time>","error":"division by zero","id":"<n>"}`,
+		},
+		{
+			"JSON array is its first element",
+			`[{"error":"nil pointer at main.go:12"},{"error":"other"}]`,
+			nil,
+			`[{"error":"nil pointer at main.go:<n>"}]`,
+		},
+		{
+			"JSON inputs",
+			`{"message":"unknown field qwerty","ok":false,"trace":null}`,
+			[]string{"qwerty"},
+			`{"message":"unknown field <input>","ok":false,"trace":null}`,
+		},
+		{
+			"JSON string is text",
+			`"error 500"`,
+			nil,
+			`"error <n>"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeBody(tt.body, tt.inputs); got != tt.want {
+				t.Errorf("normalizeBody(%q) = %q, want %q", tt.body, got, tt.want)
+			}
+		})
+	}
+
+}
+
+func TestNormalizeBodySeparatesMessages(t *testing.T) {
+
+	a := normalizeBody(`{"error":"division by zero"}`, nil)
+	b := normalizeBody(`{"error":"index out of range"}`, nil)
+	if a == b {
+		t.Errorf("different errors of the same shape share the signature %q", a)
+	}
+
+	a = normalizeBody(`{"error":"user 12 not found","request":"4b1c0e2f-aaaa-4bbb-8ccc-0123456789ab"}`, nil)
+	b = normalizeBody(`{"error":"user 345 not found","request":"00000000-1111-4222-8333-444444444444"}`, nil)
+	if a != b {
+		t.Errorf("the same error has different signatures %q and %q", a, b)
+	}
+
+}
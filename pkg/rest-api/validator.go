@@ -0,0 +1,466 @@
+package hsuanfuzz
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// DependencyProblem is a mistake of Dependency.yml found before fuzzing.
+type DependencyProblem struct {
+	File    string
+	Line    int // 0 when the location is unknown
+	Message string
+}
+
+func (p *DependencyProblem) String() string {
+
+	if p.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+	}
+
+	return fmt.Sprintf("%s: %s", p.File, p.Message)
+}
+
+// DependencyError presents all problems of Dependency.yml.
+type DependencyError struct {
+	Problems []*DependencyProblem
+}
+
+func (e *DependencyError) Error() string {
+
+	lines := []string{"invalid dependencies:"}
+	for _, p := range e.Problems {
+		lines = append(lines, p.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// yamlLines maps the keys of a YAML document to their line numbers, e.g. paths, /items, items, 0 and source.
+type yamlLines map[string]int
+
+// getYAMLLines returns the lines of the keys of the document, the lines of a sequence item are of its first key.
+func getYAMLLines(b []byte) yamlLines {
+
+	lines := yamlLines{}
+
+	doc := yamlv3.Node{}
+	if err := yamlv3.Unmarshal(b, &doc); err != nil {
+		return lines
+	}
+	lines.add(&doc, nil)
+
+	return lines
+}
+
+// add records the lines of the node n and its children, keys are the ones of n.
+func (l yamlLines) add(n *yamlv3.Node, keys []string) {
+
+	switch n.Kind {
+
+	case yamlv3.DocumentNode:
+		for _, c := range n.Content {
+			l.add(c, keys)
+		}
+
+	case yamlv3.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k := append(append([]string{}, keys...), n.Content[i].Value)
+			l[strings.Join(k, "\x00")] = n.Content[i].Line
+			l.add(n.Content[i+1], k)
+		}
+
+	case yamlv3.SequenceNode:
+		for i, c := range n.Content {
+			k := append(append([]string{}, keys...), strconv.Itoa(i))
+			l[strings.Join(k, "\x00")] = c.Line
+			l.add(c, k)
+		}
+
+	}
+
+}
+
+// get returns the line of the keys, or of the closest parent when the keys are not written, e.g. an omitted field.
+func (l yamlLines) get(keys ...string) int {
+
+	for i := len(keys); i > 0; i-- {
+		if n, ok := l[strings.Join(keys[:i], "\x00")]; ok {
+			return n
+		}
+	}
+
+	return 0
+}
+
+// learnedDependency is the content of Learned.yml, the dependencies learned from the responses.
+type learnedDependency struct {
+	Learned map[string]*DependencyInfo `yaml:"learned"`
+}
+
+// dependencyDocument is a file of the dependencies and the lines of its keys.
+type dependencyDocument struct {
+	file  string
+	lines yamlLines
+}
+
+// ReadDependency reads and validates the dependencies of the file.
+// The learned dependencies of Learned.yml in the same directory are added to Dependency.Learned, they replace the ones of the file.
+func (x *HsuanFuzz) ReadDependency(file string) (*Dependency, []*DependencyProblem, error) {
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dependency := &Dependency{}
+	if err := yaml.Unmarshal(b, dependency); err != nil {
+		return nil, nil, err
+	}
+
+	learnedFile := filepath.Join(filepath.Dir(file), "Learned.yml")
+	learnedBytes, err := ioutil.ReadFile(learnedFile)
+	if os.IsNotExist(err) {
+		return dependency, x.ValidateDependency(file, b, dependency), nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	learned := learnedDependency{}
+	if err := yaml.Unmarshal(learnedBytes, &learned); err != nil {
+		return nil, nil, err
+	}
+	if dependency.Learned == nil && len(learned.Learned) > 0 {
+		dependency.Learned = map[string]*DependencyInfo{}
+	}
+	for path, info := range learned.Learned {
+		dependency.Learned[path] = info
+	}
+
+	return dependency, x.validateDependency(&dependencyDocument{file, getYAMLLines(b)}, &dependencyDocument{learnedFile, getYAMLLines(learnedBytes)}, dependency), nil
+}
+
+// DependencyPath returns the location of Dependency.yml.
+func (x *HsuanFuzz) DependencyPath() string {
+	return x.dirPath + "Dependency.yml"
+}
+
+// LearnedPath returns the location of Learned.yml, the dependencies learned from the responses are kept apart from the manual ones.
+func (x *HsuanFuzz) LearnedPath() string {
+	return x.dirPath + "Learned.yml"
+}
+
+// ValidateDependency checks the dependencies against the specification, b is the content of file for the line numbers.
+// Cycles, unknown paths, keys which match no parameter and source keys which the response schema does not have are reported.
+func (x *HsuanFuzz) ValidateDependency(file string, b []byte, dependency *Dependency) []*DependencyProblem {
+	return x.validateDependency(&dependencyDocument{file, getYAMLLines(b)}, nil, dependency)
+}
+
+// validateDependency reports the problems at the lines of doc, or of learned for the learned paths it has.
+func (x *HsuanFuzz) validateDependency(doc *dependencyDocument, learned *dependencyDocument, dependency *Dependency) []*DependencyProblem {
+
+	problems := []*DependencyProblem{}
+	report := func(keys []string, format string, a ...interface{}) {
+		d := doc
+		if learned != nil && keys[0] == "learned" && (len(keys) == 1 || learned.lines[strings.Join(keys[:2], "\x00")] > 0) {
+			d = learned
+		}
+		problems = append(problems, &DependencyProblem{File: d.file, Line: d.lines.get(keys...), Message: fmt.Sprintf(format, a...)})
+	}
+
+	// Paths of the specification
+	for _, path := range x.sortedPaths {
+		if _, ok := dependency.Paths[path]; !ok {
+			report([]string{"paths"}, "path %s of the specification is missing", path)
+		}
+	}
+
+	sections := map[string]map[string]*DependencyInfo{"paths": dependency.Paths, "learned": dependency.Learned}
+	for _, section := range []string{"paths", "learned"} {
+
+		for _, path := range getSortedDependencyPaths(sections[section]) {
+
+			info := sections[section][path]
+			if x.openAPI.Paths[path] == nil {
+				report([]string{section, path}, "path %s is not in the specification", path)
+				continue
+			}
+			if info == nil || len(info.Items) == 0 {
+				report([]string{section, path}, "%s has no items, use source path x for no dependency", path)
+				continue
+			}
+
+			parameters := x.getParameterKeys(path)
+			for i, item := range info.Items {
+
+				at := func(keys ...string) []string {
+					return append([]string{section, path, "items", strconv.Itoa(i)}, keys...)
+				}
+
+				if item.Source == nil || item.Source.Path == "" {
+					report(at("source", "path"), "source path of %s of %s is not entered", item.Key, path)
+					continue
+				}
+
+				// No dependency
+				if item.Source.Path == "x" {
+					continue
+				}
+
+				if !parameters[item.Key] {
+					report(at("key"), "key %q matches no parameter of %s", item.Key, path)
+				}
+
+				if x.openAPI.Paths[item.Source.Path] == nil {
+					report(at("source", "path"), "source path %s is not in the specification", item.Source.Path)
+					continue
+				}
+
+				if message := x.checkSourceKey(item.Source); message != "" {
+					report(at("source", "key"), "%s", message)
+				}
+
+			}
+
+		}
+
+	}
+
+	// Cycles, reported once by the item which closes the cycle
+	const (
+		visiting = 1
+		done     = 2
+	)
+	states := map[string]int{}
+	for _, path := range getSortedDependencyPaths(dependency.Paths) {
+
+		stack := []string{}
+
+		var walk func(p string)
+		walk = func(p string) {
+
+			states[p] = visiting
+			stack = append(stack, p)
+
+			for _, section := range []string{"paths", "learned"} {
+
+				info := sections[section][p]
+				if info == nil {
+					continue
+				}
+
+				for i, item := range info.Items {
+
+					if item.Source == nil || item.Source.Path == "" || item.Source.Path == "x" || x.openAPI.Paths[item.Source.Path] == nil {
+						continue
+					}
+					source := item.Source.Path
+
+					switch states[source] {
+					case visiting:
+						cycle := []string{}
+						for j := len(stack) - 1; j >= 0; j-- {
+							cycle = append([]string{stack[j]}, cycle...)
+							if stack[j] == source {
+								break
+							}
+						}
+						report([]string{section, p, "items", strconv.Itoa(i), "source", "path"}, "cycle %s -> %s", strings.Join(cycle, " -> "), source)
+					case 0:
+						walk(source)
+					}
+
+				}
+
+			}
+
+			states[p] = done
+			stack = stack[:len(stack)-1]
+
+		}
+
+		if states[path] == 0 {
+			walk(path)
+		}
+
+	}
+
+	// Flows of level 7, every POST operation needs them
+	for _, path := range x.sortedPaths {
+		if x.openAPI.Paths[path].GetOperation(http.MethodPost) != nil && dependency.Posts[path] == nil {
+			report([]string{"posts"}, "posts %s is missing", path)
+		}
+	}
+
+	// Empty paths of flows are ignored
+	for _, path := range getSortedPostPaths(dependency.Posts) {
+
+		if x.openAPI.Paths[path] == nil || x.openAPI.Paths[path].GetOperation(http.MethodPost) == nil {
+			report([]string{"posts", path}, "posts %s is not a POST operation of the specification", path)
+			continue
+		}
+		if dependency.Posts[path] == nil {
+			continue
+		}
+
+		for i, flow := range dependency.Posts[path].Flows {
+
+			if flow.Path == "" {
+				continue
+			}
+
+			line := []string{"posts", path, "flows", strconv.Itoa(i)}
+			if x.openAPI.Paths[flow.Path] == nil {
+				report(line, "flow path %s is not in the specification", flow.Path)
+			} else if x.openAPI.Paths[flow.Path].GetOperation(flow.Method) == nil {
+				report(line, "flow %s %s is not in the specification", flow.Method, flow.Path)
+			}
+
+		}
+
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].File != problems[j].File {
+			return problems[i].File == doc.file
+		}
+		return problems[i].Line < problems[j].Line
+	})
+
+	return problems
+}
+
+func getSortedDependencyPaths(m map[string]*DependencyInfo) []string {
+
+	paths := []string{}
+	for path := range m {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+func getSortedPostPaths(m map[string]*DependencyPost) []string {
+
+	paths := []string{}
+	for path := range m {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+// getParameterKeys returns the keys of the requests of all operations of the path, which are what the items of Dependency.yml match.
+func (x *HsuanFuzz) getParameterKeys(path string) map[string]bool {
+
+	keys := map[string]bool{}
+	for _, method := range operationsOrder {
+		for key := range x.getOperationKeys(path, method) {
+			keys[key] = true
+		}
+	}
+
+	return keys
+}
+
+// getOperationKeys returns the keys of the requests of the operation.
+func (x *HsuanFuzz) getOperationKeys(path string, method string) map[string]bool {
+
+	keys := map[string]bool{}
+
+	nodes := x.newNode(0, path, method)
+	if len(nodes) == 0 {
+		return keys
+	}
+
+	for _, request := range nodes[0].Requests {
+		for _, k := range getSortedKeys(request.Value) {
+			ks, _ := getKeyValue(k, request.Value.GetFields()[k])
+			for _, key := range ks {
+				keys[key] = true
+			}
+		}
+	}
+
+	return keys
+}
+
+// checkSourceKey returns why the source key cannot be found in the responses of the source path, empty when it can.
+func (x *HsuanFuzz) checkSourceKey(source *DependencySource) string {
+
+	if source.Key == "" {
+		return "source key is not entered, e.g. /id for the id of the response"
+	}
+
+	keys, inBody, err := getSchemaKeys(source.Key)
+	if err != nil {
+		return err.Error()
+	}
+
+	// Headers are rarely documented
+	if !inBody {
+		return ""
+	}
+
+	schemas := []*openapi3.Schema{}
+	for _, method := range operationsOrder {
+		if operation := x.openAPI.Paths[source.Path].GetOperation(method); operation != nil {
+			if schema := getResponseSchema(operation); schema != nil {
+				schemas = append(schemas, schema)
+			}
+		}
+	}
+
+	if len(schemas) == 0 {
+		return fmt.Sprintf("source path %s has no JSON response", source.Path)
+	}
+
+	for _, schema := range schemas {
+		if hasSchemaKeys(schema, keys) {
+			return ""
+		}
+	}
+
+	return fmt.Sprintf("source key %s is not in the responses of %s", source.Key, source.Path)
+}
+
+// hasSchemaKeys reports whether the keys can be found by the schema, schemas without properties accept any key.
+func hasSchemaKeys(schema *openapi3.Schema, keys []string) bool {
+
+	if len(keys) == 0 {
+		return true
+	}
+
+	if schema.Type == "array" || (schema.Items != nil && schema.Items.Value != nil) {
+		if _, err := strconv.Atoi(keys[0]); err != nil || schema.Items == nil || schema.Items.Value == nil {
+			return false
+		}
+		return hasSchemaKeys(schema.Items.Value, keys[1:])
+	}
+
+	properties := getSchemaProperties(schema)
+	if len(properties) == 0 {
+		// Free-form objects and combined schemas
+		return schema.Type == "" || schema.Type == "object"
+	}
+
+	p, ok := properties[keys[0]]
+	if !ok {
+		return schema.AdditionalPropertiesAllowed != nil && *schema.AdditionalPropertiesAllowed
+	}
+
+	return hasSchemaKeys(p, keys[1:])
+}
@@ -0,0 +1,336 @@
+package hsuanfuzz
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testDependencySpec = `
+openapi: 3.0.0
+info: {title: Test, version: "1"}
+servers: [{url: "http://api.local"}]
+paths:
+  /items:
+    post:
+      requestBody: {content: {application/json: {schema: {type: object, properties: {name: {type: string}}}}}}
+      responses:
+        "201": {description: ok, content: {application/json: {schema: {type: object, properties: {id: {type: string}}}}}}
+  /items/{itemId}:
+    get:
+      parameters: [{name: itemId, in: path, required: true, schema: {type: string}}]
+      responses:
+        "200": {description: ok, content: {application/json: {schema: {type: object, properties: {id: {type: string}, ownerId: {type: string}}}}}}
+  /owners/{ownerId}:
+    get:
+      parameters: [{name: ownerId, in: path, required: true, schema: {type: string}}]
+      responses: {"200": {description: ok}}
+`
+
+func TestGetYAMLLines(t *testing.T) {
+
+	b := []byte(`# comment
+paths:
+  /items/{itemId}:
+    items:
+    - key: itemId
+      source:
+        path: /items
+
+        key: /id
+    -   key: "name"
+  "/b":
+    items:
+      - key: x
+posts: {}
+`)
+
+	tests := []struct {
+		keys []string
+		want int
+	}{
+		{[]string{"paths"}, 2},
+		{[]string{"paths", "/items/{itemId}"}, 3},
+		{[]string{"paths", "/items/{itemId}", "items", "0"}, 5},
+		{[]string{"paths", "/items/{itemId}", "items", "0", "key"}, 5},
+		{[]string{"paths", "/items/{itemId}", "items", "0", "source", "path"}, 7},
+		{[]string{"paths", "/items/{itemId}", "items", "0", "source", "key"}, 9},
+		{[]string{"paths", "/items/{itemId}", "items", "1", "key"}, 10},
+		{[]string{"paths", "/b", "items", "0", "key"}, 13},
+		{[]string{"posts"}, 14},
+		// The closest parent of the keys which are not written
+		{[]string{"paths", "/items/{itemId}", "items", "1", "source", "path"}, 10},
+		{[]string{"learned", "/items"}, 0},
+	}
+
+	lines := getYAMLLines(b)
+	for _, tt := range tests {
+		if got := lines.get(tt.keys...); got != tt.want {
+			t.Errorf("line of %q = %d, want %d", tt.keys, got, tt.want)
+		}
+	}
+
+}
+
+func TestValidateDependency(t *testing.T) {
+
+	x := newTestFuzz(t, testDependencySpec)
+
+	const posts = `posts:
+  /items:
+    flows:
+    - method: GET
+      path: /items/{itemId}
+`
+
+	tests := []struct {
+		name string
+		yaml string
+		want []string
+	}{
+		{
+			"valid",
+			`paths:
+  /items:
+    items:
+    - key: ""
+      source: {path: x}
+  /items/{itemId}:
+    items:
+    - key: itemId
+      source: {path: /items, key: /id}
+  /owners/{ownerId}:
+    items:
+    - key: ownerId
+      source: {path: "/items/{itemId}", key: /ownerId}
+` + posts,
+			[]string{},
+		},
+		{
+			"mistakes of the items",
+			`paths:
+  /items:
+    items: []
+  /items/{itemId}:
+    items:
+    - key: id
+      source:
+        path: /items
+        key: /name
+  /owners/{ownerId}:
+    items:
+    - key: ownerId
+      source:
+        path: ""
+  /nope:
+    items:
+    - key: x
+      source: {path: x}
+` + posts,
+			[]string{
+				"Dependency.yml:2: /items has no items, use source path x for no dependency",
+				"Dependency.yml:6: key \"id\" matches no parameter of /items/{itemId}",
+				"Dependency.yml:9: source key /name is not in the responses of /items",
+				"Dependency.yml:14: source path of ownerId of /owners/{ownerId} is not entered",
+				"Dependency.yml:15: path /nope is not in the specification",
+			},
+		},
+		{
+			"missing paths and posts",
+			`paths:
+  /items:
+    items:
+    - source: {path: x}
+posts: {}
+`,
+			[]string{
+				"Dependency.yml:1: path /items/{itemId} of the specification is missing",
+				"Dependency.yml:1: path /owners/{ownerId} of the specification is missing",
+				"Dependency.yml:5: posts /items is missing",
+			},
+		},
+		{
+			"cycle of paths",
+			`paths:
+  /items:
+    items:
+    - source: {path: x}
+  /items/{itemId}:
+    items:
+    - key: itemId
+      source: {path: "/owners/{ownerId}", key: /id}
+  /owners/{ownerId}:
+    items:
+    - key: ownerId
+      source: {path: "/items/{itemId}", key: /ownerId}
+` + posts,
+			[]string{
+				"Dependency.yml:8: source path /owners/{ownerId} has no JSON response",
+				"Dependency.yml:12: cycle /items/{itemId} -> /owners/{ownerId} -> /items/{itemId}",
+			},
+		},
+		{
+			"cycle across paths and learned",
+			`paths:
+  /items:
+    items:
+    - source: {path: x}
+  /items/{itemId}:
+    items:
+    - source: {path: x}
+  /owners/{ownerId}:
+    items:
+    - key: ownerId
+      source: {path: "/items/{itemId}", key: /ownerId}
+` + posts + `learned:
+  /items/{itemId}:
+    items:
+    - key: itemId
+      source:
+        path: /owners/{ownerId}
+        key: /id
+`,
+			[]string{
+				"Dependency.yml:11: cycle /items/{itemId} -> /owners/{ownerId} -> /items/{itemId}",
+				"Dependency.yml:23: source path /owners/{ownerId} has no JSON response",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			dependency, problems := readTestDependency(t, x, tt.yaml, "")
+
+			got := []string{}
+			for _, p := range problems {
+				got = append(got, filepath.Base(p.File)+p.String()[len(p.File):])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got the problems\n%q\nwant\n%q\nof %+v", got, tt.want, dependency)
+			}
+
+		})
+	}
+
+}
+
+func TestReadDependencyLearned(t *testing.T) {
+
+	x := newTestFuzz(t, testDependencySpec)
+
+	manual := `paths:
+  /items:
+    items:
+    - source: {path: x}
+  /items/{itemId}:
+    items:
+    - source: {path: x}
+  /owners/{ownerId}:
+    items:
+    - key: ownerId
+      source: {path: "/items/{itemId}", key: /ownerId}
+posts:
+  /items:
+    flows: []
+learned:
+  /owners/{ownerId}:
+    items:
+    - key: ownerId
+      source: {path: /nope, key: /id}
+`
+	learned := `learned:
+  /items/{itemId}:
+    items:
+    - key: itemId
+      source:
+        path: /owners/{ownerId}
+        key: /id
+`
+
+	dependency, problems := readTestDependency(t, x, manual, learned)
+
+	if len(dependency.Learned) != 2 || dependency.Learned["/items/{itemId}"].Items[0].Source.Path != "/owners/{ownerId}" {
+		t.Errorf("learned dependencies are not added: %v", dependency.Learned)
+	}
+
+	// The problems of the learned paths of Learned.yml are at its lines, the others at the lines of Dependency.yml
+	got := []string{}
+	for _, p := range problems {
+		got = append(got, filepath.Base(p.File)+p.String()[len(p.File):])
+	}
+	want := []string{
+		"Dependency.yml:11: cycle /items/{itemId} -> /owners/{ownerId} -> /items/{itemId}",
+		"Dependency.yml:19: source path /nope is not in the specification",
+		"Learned.yml:7: source path /owners/{ownerId} has no JSON response",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got the problems\n%q\nwant\n%q", got, want)
+	}
+
+}
+
+// readTestDependency writes Dependency.yml and Learned.yml when it is not empty, and reads them with ReadDependency.
+func readTestDependency(t *testing.T, x *HsuanFuzz, manual string, learned string) (*Dependency, []*DependencyProblem) {
+
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "Dependency.yml"), []byte(manual), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if learned != "" {
+		if err := ioutil.WriteFile(filepath.Join(dir, "Learned.yml"), []byte(learned), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dependency, problems, err := x.ReadDependency(filepath.Join(dir, "Dependency.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dependency, problems
+}
+
+func TestNewDependencyErrors(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		yaml      string
+		wantError bool // a DependencyError of the problems
+	}{
+		{"invalid YAML", "paths: [", false},
+		{"problems", "paths: {}\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			dir := t.TempDir()
+			files := map[string]string{
+				"openapi.yaml":        strings.Replace(testDependencySpec, "http://api.local", "http://127.0.0.1:1", 1),
+				"Test/Token.yml":      "bearer: x\n",
+				"Test/Info.yml":       "",
+				"Test/Dependency.yml": tt.yaml,
+			}
+			for name, content := range files {
+				os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0770)
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0660); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := New(filepath.Join(dir, "openapi.yaml"), dir+"/", false, true)
+			if err == nil {
+				t.Fatal("no error")
+			}
+			if _, ok := err.(*DependencyError); ok != tt.wantError {
+				t.Errorf("got the error %v", err)
+			}
+
+		})
+	}
+
+}
@@ -0,0 +1,151 @@
+package hsuanfuzz
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/iasthc/hsuan-fuzz/internal/base"
+)
+
+// sendGroups sends the nodes of the grammar with workers.
+// Nodes of the same group are sent in order, so the dependency values flow from producers to consumers.
+func (x *HsuanFuzz) sendGroups(ctx context.Context, c *campaign, opts Options) map[uint32][]*ResponseInfo {
+
+	// Keep the order of groups
+	groups := []uint32{}
+	nodes := map[uint32][]*base.Node{}
+	for _, node := range x.grammar.Nodes {
+		if _, ok := nodes[node.Group]; !ok {
+			groups = append(groups, node.Group)
+		}
+		nodes[node.Group] = append(nodes[node.Group], node)
+	}
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	mu := sync.Mutex{}
+	mapInfos := map[uint32][]*ResponseInfo{}
+
+	queue := make(chan uint32)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for group := range queue {
+
+				infos := []*ResponseInfo{}
+				for _, node := range nodes[group] {
+
+					if ctx.Err() != nil || !c.reserve(opts.Budget.Requests) {
+						break
+					}
+
+					info, probes := x.sendProbed(ctx, node, true)
+
+					// The response of a canceled request is not the target behaviour
+					if ctx.Err() != nil {
+						break
+					}
+
+					c.print(info)
+					c.addProbes(len(probes) - 1)
+
+					// Throttled responses and timeouts pollute the coverage levels
+					if info.Throttled || info.Timeout {
+						c.addUnanswered(info)
+					} else {
+						infos = append(infos, info)
+						x.learn(node, info)
+					}
+
+					// The findings of probes are saved with their responses
+					for _, p := range probes {
+						for _, finding := range p.Findings {
+
+							name, isNew := x.saveCrasher(node, p.Info, finding)
+							c.addCrasher(name)
+
+							if opts.Minimize && isNew {
+								x.saveMinimized(ctx, c, opts.Budget.Requests, name, node)
+							}
+
+							// The other workers stop at once
+							if opts.Budget.StopOnCrash {
+								c.stop()
+							}
+
+						}
+					}
+
+				}
+
+				mu.Lock()
+				mapInfos[group] = infos
+				mu.Unlock()
+
+			}
+		}()
+
+	}
+
+	for _, group := range groups {
+		queue <- group
+	}
+	close(queue)
+	wg.Wait()
+
+	return mapInfos
+}
+
+// reserve counts a request if it is still within the limit, 0 means unlimited.
+func (c *campaign) reserve(limit int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if limit > 0 && c.requests >= limit {
+		return false
+	}
+	c.requests++
+
+	return true
+}
+
+func (c *campaign) addCrasher(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.crashers[name] = true
+}
+
+// addProbes counts the requests sent by active oracles, they are not limited by the budget.
+func (c *campaign) addProbes(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.requests += n
+}
+
+func (c *campaign) addUnanswered(info *ResponseInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if info.Timeout {
+		c.timeouts++
+	} else {
+		c.throttled++
+	}
+}
+
+func (c *campaign) print(info *ResponseInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Printf("\r%d: %d %-7s %-100s", c.iterations+1, info.Code, info.request.Method, info.request.Path)
+}
@@ -0,0 +1,160 @@
+package hsuanfuzz
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testItemsPaths = `
+paths:
+  /items:
+    post:
+      requestBody: {content: {application/json: {schema: {type: object, properties: {name: {type: string}, count: {type: integer}}}}}}
+      responses:
+        "201": {description: ok, content: {application/json: {schema: {type: object, properties: {id: {type: string}}}}}}
+  /items/{itemId}:
+    get:
+      parameters: [{name: itemId, in: path, required: true, schema: {type: string}}]
+      responses: {"200": {description: ok}}
+`
+
+// newTestCampaign returns the fuzzer of the paths with a new corpus in a temporary directory, the target is the server.
+func newTestCampaign(t *testing.T, server string, paths string) *HsuanFuzz {
+
+	dir := t.TempDir()
+	spec := filepath.Join(dir, "openapi.yaml")
+	content := "openapi: 3.0.0\ninfo: {title: Test, version: \"1\"}\nservers: [{url: \"" + server + "\"}]\n" + paths
+	if err := ioutil.WriteFile(spec, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	x, err := New(spec, dir+"/", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return x
+}
+
+// requestLog records the requests of a test server in their order.
+type requestLog struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (l *requestLog) add(r *http.Request) int {
+
+	b, _ := ioutil.ReadAll(r.Body)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.requests = append(l.requests, r.Method+" "+r.URL.RequestURI()+" "+string(b))
+
+	return len(l.requests)
+}
+
+func TestFuzzContextSameSeed(t *testing.T) {
+
+	run := func() []string {
+
+		l := &requestLog{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := l.add(r)
+			if r.Method == http.MethodPost {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"id":"` + strings.Repeat("a", n%5+1) + `"}`))
+			}
+		}))
+		defer server.Close()
+
+		x := newTestCampaign(t, server.URL, testItemsPaths)
+		summary, err := x.FuzzContext(context.Background(), Options{Budget: Budget{Iterations: 20}, Workers: 1, Seed: 7})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary.Requests != len(l.requests) {
+			t.Errorf("summary has %d requests, the server got %d", summary.Requests, len(l.requests))
+		}
+
+		return l.requests
+	}
+
+	a, b := run(), run()
+	if len(a) == 0 {
+		t.Fatal("no requests")
+	}
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("the same seed sent different requests:\n%q\n%q", a, b)
+	}
+
+}
+
+func TestFuzzContextStops(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		budget     Budget
+		cancel     bool
+		workers    int
+		wantReason string
+	}{
+		{"canceled while reading a body", Budget{}, true, 1, "canceled"},
+		{"canceled with workers", Budget{}, true, 4, "canceled"},
+		{"duration while reading a body", Budget{Duration: 200 * time.Millisecond}, false, 1, "duration"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// The body of the third request stalls until the request is canceled, then the server fails
+			l := &requestLog{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if l.add(r) < 3 {
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+				w.(http.Flusher).Flush()
+				if tt.cancel {
+					cancel()
+				}
+				<-r.Context().Done()
+			}))
+			defer server.Close()
+
+			x := newTestCampaign(t, server.URL, testItemsPaths)
+
+			done := make(chan *Summary)
+			go func() {
+				summary, err := x.FuzzContext(ctx, Options{Budget: tt.budget, Workers: tt.workers, Seed: 1})
+				if err != nil {
+					t.Error(err)
+				}
+				done <- summary
+			}()
+
+			select {
+			case summary := <-done:
+				if summary.Reason != tt.wantReason || summary.Crashers != 0 || summary.Timeouts != 0 {
+					t.Errorf("got %v, want reason %s without crashers and timeouts", summary, tt.wantReason)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("the campaign did not stop")
+			}
+
+		})
+	}
+
+}